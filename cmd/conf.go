@@ -1,31 +1,71 @@
 package cmd
 
 import (
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rendau/dop/dopTools"
+	"github.com/rendau/fs/internal/domain/types"
 	"github.com/spf13/viper"
 )
 
 var conf = struct {
-	Debug            bool    `mapstructure:"DEBUG"`
-	LogLevel         string  `mapstructure:"LOG_LEVEL"`
-	HttpListen       string  `mapstructure:"HTTP_LISTEN"`
-	HttpCors         bool    `mapstructure:"HTTP_CORS"`
-	SwagHost         string  `mapstructure:"SWAG_HOST"`
-	SwagBasePath     string  `mapstructure:"SWAG_BASE_PATH"`
-	SwagSchema       string  `mapstructure:"SWAG_SCHEMA"`
-	DirPath          string  `mapstructure:"DIR_PATH"`
-	CleanApiUrl      string  `mapstructure:"CLEAN_API_URL"`
-	ImgMaxWidth      int     `mapstructure:"IMG_MAX_WIDTH"`
-	ImgMaxHeight     int     `mapstructure:"IMG_MAX_HEIGHT"`
-	WmPath           string  `mapstructure:"WM_PATH"`
-	WmOpacity        float64 `mapstructure:"WM_OPACITY"`
-	WmDirPaths       string  `mapstructure:"WM_DIR_PATHS"`
-	WmDirPathsParsed []string
-	CacheCount       int           `mapstructure:"CACHE_COUNT"`
-	CacheDuration    time.Duration `mapstructure:"CACHE_DURATION"`
+	Debug                   bool    `mapstructure:"DEBUG"`
+	LogLevel                string  `mapstructure:"LOG_LEVEL"`
+	HttpListen              string  `mapstructure:"HTTP_LISTEN"`
+	HttpCors                bool    `mapstructure:"HTTP_CORS"`
+	SwagHost                string  `mapstructure:"SWAG_HOST"`
+	SwagBasePath            string  `mapstructure:"SWAG_BASE_PATH"`
+	SwagSchema              string  `mapstructure:"SWAG_SCHEMA"`
+	DirPath                 string  `mapstructure:"DIR_PATH"`
+	S3Endpoint              string  `mapstructure:"S3_ENDPOINT"`
+	S3AccessKey             string  `mapstructure:"S3_ACCESS_KEY"`
+	S3SecretKey             string  `mapstructure:"S3_SECRET_KEY"`
+	S3Region                string  `mapstructure:"S3_REGION"`
+	S3Bucket                string  `mapstructure:"S3_BUCKET"`
+	S3Prefix                string  `mapstructure:"S3_PREFIX"`
+	S3UseSsl                bool    `mapstructure:"S3_USE_SSL"`
+	CleanApiUrl             string  `mapstructure:"CLEAN_API_URL"`
+	ImgMaxWidth             int     `mapstructure:"IMG_MAX_WIDTH"`
+	ImgMaxHeight            int     `mapstructure:"IMG_MAX_HEIGHT"`
+	ImgAutoFormat           bool    `mapstructure:"IMG_AUTO_FORMAT"`
+	ImgQualityDefault       int     `mapstructure:"IMG_QUALITY_DEFAULT"`
+	ImgQualityMax           int     `mapstructure:"IMG_QUALITY_MAX"`
+	ImgLimitMaxWidth        int     `mapstructure:"IMG_LIMIT_MAX_WIDTH"`
+	ImgLimitMaxHeight       int     `mapstructure:"IMG_LIMIT_MAX_HEIGHT"`
+	ImgLimitMaxBlur         float64 `mapstructure:"IMG_LIMIT_MAX_BLUR"`
+	ImgLimitSizes           string  `mapstructure:"IMG_LIMIT_SIZES"`
+	ImgLimitSizesParsed     []types.ImgSizeSt
+	ImgLimitMaxSourcePixels int64         `mapstructure:"IMG_LIMIT_MAX_SOURCE_PIXELS"`
+	ImgLimitMaxUploadPixels int64         `mapstructure:"IMG_LIMIT_MAX_UPLOAD_PIXELS"`
+	ImgConcurrency          int           `mapstructure:"IMG_CONCURRENCY"`
+	ImgQueueTimeout         time.Duration `mapstructure:"IMG_QUEUE_TIMEOUT"`
+	ImgPresets              string        `mapstructure:"IMG_PRESETS"`
+	ImgPresetsParsed        map[string]string
+	ImgPresetsStrict        bool    `mapstructure:"IMG_PRESETS_STRICT"`
+	WmPath                  string  `mapstructure:"WM_PATH"`
+	WmOpacity               float64 `mapstructure:"WM_OPACITY"`
+	WmDirPaths              string  `mapstructure:"WM_DIR_PATHS"`
+	WmDirPathsParsed        []string
+	ZipMaxSize              int64   `mapstructure:"ZIP_MAX_SIZE"`
+	ZipMaxFileSize          int64   `mapstructure:"ZIP_MAX_FILE_SIZE"`
+	ZipMaxEntries           int     `mapstructure:"ZIP_MAX_ENTRIES"`
+	ZipMaxRatio             float64 `mapstructure:"ZIP_MAX_RATIO"`
+	AuthApiKeys             string  `mapstructure:"AUTH_API_KEYS"`
+	AuthApiKeysParsed       map[string]*types.AuthScopeSt
+	AuthJwtSecret           string `mapstructure:"AUTH_JWT_SECRET"`
+	UrlSignSecret           string `mapstructure:"URL_SIGN_SECRET"`
+	PrivateDirPaths         string `mapstructure:"PRIVATE_DIR_PATHS"`
+	PrivateDirPathsParsed   []string
+	CacheCount              int           `mapstructure:"CACHE_COUNT"`
+	CacheSize               int64         `mapstructure:"CACHE_SIZE"`
+	CacheMaxEntrySize       int64         `mapstructure:"CACHE_MAX_ENTRY_SIZE"`
+	CacheDuration           time.Duration `mapstructure:"CACHE_DURATION"`
+	DiskCacheDirPath        string        `mapstructure:"DISK_CACHE_DIR_PATH"`
+	DiskCacheSize           int64         `mapstructure:"DISK_CACHE_SIZE"`
+	DiskCacheDuration       time.Duration `mapstructure:"DISK_CACHE_DURATION"`
 }{}
 
 func confLoad() {
@@ -37,17 +77,34 @@ func confLoad() {
 	viper.SetDefault("SWAG_HOST", "example.com")
 	viper.SetDefault("SWAG_BASE_PATH", "/")
 	viper.SetDefault("SWAG_SCHEMA", "https")
+	viper.SetDefault("IMG_CONCURRENCY", runtime.NumCPU())
+	viper.SetDefault("IMG_QUEUE_TIMEOUT", "10s")
+	viper.SetDefault("IMG_LIMIT_MAX_WIDTH", 5000)
+	viper.SetDefault("IMG_LIMIT_MAX_HEIGHT", 5000)
+	viper.SetDefault("IMG_LIMIT_MAX_BLUR", 50)
+	viper.SetDefault("IMG_LIMIT_MAX_SOURCE_PIXELS", 50_000_000)
+	viper.SetDefault("DISK_CACHE_SIZE", 1024*1024*1024)
+	viper.SetDefault("ZIP_MAX_SIZE", 1024*1024*1024)
+	viper.SetDefault("ZIP_MAX_ENTRIES", 10000)
+	viper.SetDefault("ZIP_MAX_RATIO", 100)
 
 	viper.SetConfigFile("conf.yml")
 	_ = viper.ReadInConfig()
 
 	viper.AutomaticEnv()
 
+	// uploads are limited like derivatives, if not set
+	viper.SetDefault("IMG_LIMIT_MAX_UPLOAD_PIXELS", viper.GetInt64("IMG_LIMIT_MAX_SOURCE_PIXELS"))
+
 	_ = viper.Unmarshal(&conf)
 }
 
 func confParse() {
 	conf.WmDirPathsParsed = confParseWMarkDirPaths(conf.WmDirPaths)
+	conf.AuthApiKeysParsed = confParseAuthApiKeys(conf.AuthApiKeys)
+	conf.PrivateDirPathsParsed = confParseWMarkDirPaths(conf.PrivateDirPaths)
+	conf.ImgPresetsParsed = confParseImgPresets(conf.ImgPresets)
+	conf.ImgLimitSizesParsed = confParseImgSizes(conf.ImgLimitSizes)
 }
 
 func confParseWMarkDirPaths(src string) []string {
@@ -61,3 +118,81 @@ func confParseWMarkDirPaths(src string) []string {
 
 	return result
 }
+
+// confParseAuthApiKeys parses "key1:dirs=photos,docs:kvs=cfg_:admin;key2:dirs=*"
+func confParseAuthApiKeys(src string) map[string]*types.AuthScopeSt {
+	result := map[string]*types.AuthScopeSt{}
+
+	for _, item := range strings.Split(src, ";") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+
+		if parts[0] == "" {
+			continue
+		}
+
+		scope := &types.AuthScopeSt{}
+
+		for _, p := range parts[1:] {
+			name, value, _ := strings.Cut(p, "=")
+
+			switch name {
+			case "dirs":
+				scope.Dirs = confParseList(value)
+			case "kvs":
+				scope.KvsPrefixes = confParseList(value)
+			case "admin":
+				scope.Admin = true
+			}
+		}
+
+		result[parts[0]] = scope
+	}
+
+	return result
+}
+
+// confParseImgPresets parses "thumb:w=300&h=200&m=fit;avatar:w=100&h=100"
+func confParseImgPresets(src string) map[string]string {
+	result := map[string]string{}
+
+	for _, item := range strings.Split(src, ";") {
+		name, query, _ := strings.Cut(strings.TrimSpace(item), ":")
+
+		if name != "" {
+			result[name] = query
+		}
+	}
+
+	return result
+}
+
+// confParseImgSizes parses "300x200;100x0"
+func confParseImgSizes(src string) []types.ImgSizeSt {
+	result := make([]types.ImgSizeSt, 0)
+
+	for _, item := range strings.Split(src, ";") {
+		wStr, hStr, _ := strings.Cut(strings.TrimSpace(item), "x")
+
+		w, wErr := strconv.Atoi(wStr)
+		h, hErr := strconv.Atoi(hStr)
+		if wErr != nil || hErr != nil {
+			continue
+		}
+
+		result = append(result, types.ImgSizeSt{Width: w, Height: h})
+	}
+
+	return result
+}
+
+func confParseList(src string) []string {
+	result := make([]string, 0)
+
+	for _, v := range strings.Split(src, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
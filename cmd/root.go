@@ -16,15 +16,20 @@ import (
 	cleanerCleaner "github.com/rendau/fs/internal/adapters/cleaner/cleaner"
 	cleanerMock "github.com/rendau/fs/internal/adapters/cleaner/mock"
 	"github.com/rendau/fs/internal/adapters/server/rest"
+	"github.com/rendau/fs/internal/adapters/storage"
+	storageLocal "github.com/rendau/fs/internal/adapters/storage/local"
+	storageS3 "github.com/rendau/fs/internal/adapters/storage/s3"
 	"github.com/rendau/fs/internal/domain/core"
+	"github.com/rendau/fs/internal/domain/types"
 )
 
 func Execute() {
-	// var err error
+	var err error
 
 	app := struct {
 		lg         *dopLoggerZap.St
 		cleaner    cleaner.Cleaner
+		storage    storage.Storage
 		core       *core.St
 		restApi    *rest.St
 		restApiSrv *dopServerHttps.St
@@ -54,17 +59,69 @@ func Execute() {
 		app.cleaner = cleanerMock.New()
 	}
 
+	if conf.S3Endpoint != "" {
+		app.storage, err = storageS3.New(
+			conf.S3Endpoint,
+			conf.S3AccessKey,
+			conf.S3SecretKey,
+			conf.S3Region,
+			conf.S3Bucket,
+			conf.S3Prefix,
+			conf.S3UseSsl,
+		)
+		if err != nil {
+			app.lg.Fatalw("Fail to create s3 storage", err)
+		}
+	} else {
+		app.storage = storageLocal.New(conf.DirPath)
+	}
+
+	var diskCacheStorage storage.Storage
+	if conf.DiskCacheDirPath != "" {
+		diskCacheStorage = storageLocal.New(conf.DiskCacheDirPath)
+	}
+
 	app.core = core.New(
 		app.lg,
 		app.cleaner,
-		conf.DirPath,
-		conf.ImgMaxWidth,
-		conf.ImgMaxHeight,
-		conf.WmPath,
-		conf.WmOpacity,
-		conf.WmDirPathsParsed,
-		conf.CacheCount,
-		conf.CacheDuration,
+		app.storage,
+		diskCacheStorage,
+		core.ConfSt{
+			ImgMaxWidth:       conf.ImgMaxWidth,
+			ImgMaxHeight:      conf.ImgMaxHeight,
+			ImgAutoFormat:     conf.ImgAutoFormat,
+			ImgQualityDefault: conf.ImgQualityDefault,
+			ImgQualityMax:     conf.ImgQualityMax,
+			ImgLimits: types.ImgLimitsSt{
+				MaxWidth:        conf.ImgLimitMaxWidth,
+				MaxHeight:       conf.ImgLimitMaxHeight,
+				MaxBlur:         conf.ImgLimitMaxBlur,
+				Sizes:           conf.ImgLimitSizesParsed,
+				MaxSourcePixels: conf.ImgLimitMaxSourcePixels,
+				MaxUploadPixels: conf.ImgLimitMaxUploadPixels,
+			},
+			ImgConcurrency:  conf.ImgConcurrency,
+			ImgQueueTimeout: conf.ImgQueueTimeout,
+			WMarkPath:       conf.WmPath,
+			WMarkOpacity:    conf.WmOpacity,
+			WMarkDirPaths:   conf.WmDirPathsParsed,
+			ZipLimits: types.ZipLimitsSt{
+				MaxSize:     conf.ZipMaxSize,
+				MaxFileSize: conf.ZipMaxFileSize,
+				MaxEntries:  conf.ZipMaxEntries,
+				MaxRatio:    conf.ZipMaxRatio,
+			},
+			AuthApiKeys:       conf.AuthApiKeysParsed,
+			AuthJwtSecret:     conf.AuthJwtSecret,
+			UrlSignSecret:     conf.UrlSignSecret,
+			PrivateDirPaths:   conf.PrivateDirPathsParsed,
+			CacheCount:        conf.CacheCount,
+			CacheSize:         conf.CacheSize,
+			CacheMaxEntrySize: conf.CacheMaxEntrySize,
+			CacheTtl:          conf.CacheDuration,
+			DiskCacheSize:     conf.DiskCacheSize,
+			DiskCacheTtl:      conf.DiskCacheDuration,
+		},
 		false,
 	)
 
@@ -85,6 +142,8 @@ func Execute() {
 			app.lg,
 			app.core,
 			conf.HttpCors,
+			conf.ImgPresetsParsed,
+			conf.ImgPresetsStrict,
 		),
 		app.lg,
 	)
@@ -16,6 +16,122 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/cache/purge": {
+            "post": {
+                "tags": [
+                    "cache"
+                ],
+                "summary": "Purge memory and disk cache entries by key, by path prefix or all.",
+                "parameters": [
+                    {
+                        "description": "body",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/rest.CachePurgeReqSt"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rest.CachePurgeRepSt"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    }
+                }
+            }
+        },
+        "/cache/stats": {
+            "get": {
+                "tags": [
+                    "cache"
+                ],
+                "summary": "Statistics of memory and disk caches.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rest.CacheStatsRepSt"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    }
+                }
+            }
+        },
+        "/cache/warmup": {
+            "post": {
+                "tags": [
+                    "cache"
+                ],
+                "summary": "Create derivatives of files for presets.",
+                "parameters": [
+                    {
+                        "description": "body",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/rest.CacheWarmUpReqSt"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rest.CacheWarmUpRepSt"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    }
+                }
+            }
+        },
         "/kvs/:key": {
             "get": {
                 "produces": [
@@ -75,6 +191,18 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dopTypes.ErrRep"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
                     }
                 }
             },
@@ -101,6 +229,147 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dopTypes.ErrRep"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    }
+                }
+            }
+        },
+        "/list/:path": {
+            "get": {
+                "tags": [
+                    "static"
+                ],
+                "summary": "List entries of dir.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "path",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "from 0",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "default 100, max 1000",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "name": "sort_desc",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "name",
+                            "size",
+                            "mtime"
+                        ],
+                        "type": "string",
+                        "name": "sort_name",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rest.ListRepSt"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    }
+                }
+            }
+        },
+        "/meta/:path": {
+            "get": {
+                "tags": [
+                    "static"
+                ],
+                "summary": "Get metadata of file.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "path",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.StaticMetaSt"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Metrics in prometheus text format.",
+                "responses": {
+                    "200": {
+                        "description": "OK"
                     }
                 }
             }
@@ -136,6 +405,24 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dopTypes.ErrRep"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
                     }
                 }
             }
@@ -157,16 +444,82 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "hex background color for \"pad\" method, default: transparent (white for jpeg)",
+                        "name": "bg",
+                        "in": "query"
+                    },
                     {
                         "type": "number",
                         "name": "blur",
                         "in": "query"
                     },
+                    {
+                        "type": "number",
+                        "description": "-100..100",
+                        "name": "brightness",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "-100..100",
+                        "name": "contrast",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "\"x,y,w,h\" in source image pixels",
+                        "name": "crop",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "name": "download",
                         "in": "query"
                     },
+                    {
+                        "enum": [
+                            "h",
+                            "v",
+                            "hv"
+                        ],
+                        "type": "string",
+                        "name": "flip",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "jpeg",
+                            "png",
+                            "webp"
+                        ],
+                        "type": "string",
+                        "name": "fmt",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "center",
+                            "north",
+                            "south",
+                            "east",
+                            "west",
+                            "north-east",
+                            "north-west",
+                            "south-east",
+                            "south-west"
+                        ],
+                        "type": "string",
+                        "name": "g",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "1 - no changes",
+                        "name": "gamma",
+                        "in": "query"
+                    },
                     {
                         "type": "boolean",
                         "name": "grayscale",
@@ -178,25 +531,335 @@ const docTemplate = `{
                         "in": "query"
                     },
                     {
+                        "enum": [
+                            "fill",
+                            "fit",
+                            "pad"
+                        ],
                         "type": "string",
                         "name": "m",
                         "in": "query"
                     },
+                    {
+                        "type": "string",
+                        "name": "preset",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "name": "w",
+                        "description": "jpeg/webp quality or png compression (1-100)",
+                        "name": "q",
                         "in": "query"
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK"
+                    },
+                    {
+                        "enum": [
+                            90,
+                            180,
+                            270
+                        ],
+                        "type": "integer",
+                        "description": "clockwise",
+                        "name": "rotate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "-100..500",
+                        "name": "saturation",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "name": "sharpen",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "name": "w",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "tags": [
+                    "static"
+                ],
+                "summary": "Remove file or zip-dir.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "path",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    }
+                }
+            },
+            "head": {
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "static"
+                ],
+                "summary": "Get or download file.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "path",
+                        "name": "path",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "hex background color for \"pad\" method, default: transparent (white for jpeg)",
+                        "name": "bg",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "name": "blur",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "-100..100",
+                        "name": "brightness",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "-100..100",
+                        "name": "contrast",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "\"x,y,w,h\" in source image pixels",
+                        "name": "crop",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "name": "download",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "h",
+                            "v",
+                            "hv"
+                        ],
+                        "type": "string",
+                        "name": "flip",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "jpeg",
+                            "png",
+                            "webp"
+                        ],
+                        "type": "string",
+                        "name": "fmt",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "center",
+                            "north",
+                            "south",
+                            "east",
+                            "west",
+                            "north-east",
+                            "north-west",
+                            "south-east",
+                            "south-west"
+                        ],
+                        "type": "string",
+                        "name": "g",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "1 - no changes",
+                        "name": "gamma",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "name": "grayscale",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "name": "h",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "fill",
+                            "fit",
+                            "pad"
+                        ],
+                        "type": "string",
+                        "name": "m",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "name": "preset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "jpeg/webp quality or png compression (1-100)",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            90,
+                            180,
+                            270
+                        ],
+                        "type": "integer",
+                        "description": "clockwise",
+                        "name": "rotate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "-100..500",
+                        "name": "saturation",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "name": "sharpen",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "name": "w",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/dopTypes.ErrRep"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    }
+                }
+            }
+        },
+        "/static/sign": {
+            "post": {
+                "tags": [
+                    "static"
+                ],
+                "summary": "Create signed url for file in private dir.",
+                "parameters": [
+                    {
+                        "description": "body",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/rest.SignReqSt"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rest.SignRepSt"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dopTypes.ErrRep"
+                        }
                     }
                 }
             }
@@ -220,6 +883,98 @@ const docTemplate = `{
                 }
             }
         },
+        "rest.CachePurgeRepSt": {
+            "type": "object",
+            "properties": {
+                "removed": {
+                    "description": "count of removed memory and disk cache entries",
+                    "type": "integer"
+                }
+            }
+        },
+        "rest.CachePurgeReqSt": {
+            "type": "object",
+            "properties": {
+                "all": {
+                    "type": "boolean"
+                },
+                "key": {
+                    "description": "exact cache-key",
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "path of file or dir",
+                    "type": "string"
+                }
+            }
+        },
+        "rest.CacheStatsRepSt": {
+            "type": "object",
+            "properties": {
+                "disk": {
+                    "$ref": "#/definitions/types.CacheStatsSt"
+                },
+                "memory": {
+                    "$ref": "#/definitions/types.CacheStatsSt"
+                }
+            }
+        },
+        "rest.CacheWarmUpRepSt": {
+            "type": "object",
+            "properties": {
+                "done": {
+                    "type": "integer"
+                },
+                "errors": {
+                    "description": "\"path?preset\" (or \"path?preset\u0026format=webp\" for auto format) -\u003e error",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "rest.CacheWarmUpReqSt": {
+            "type": "object",
+            "required": [
+                "paths",
+                "presets"
+            ],
+            "properties": {
+                "paths": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "presets": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "rest.ListRepSt": {
+            "type": "object",
+            "properties": {
+                "page": {
+                    "type": "integer"
+                },
+                "page_size": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.StaticListItemSt"
+                    }
+                },
+                "total_count": {
+                    "type": "integer"
+                }
+            }
+        },
         "rest.SaveRepSt": {
             "type": "object",
             "properties": {
@@ -246,6 +1001,133 @@ const docTemplate = `{
                 },
                 "no_cut": {
                     "type": "boolean"
+                },
+                "tags": {
+                    "description": "json object of strings, e.g. {\"owner\": \"123\"}",
+                    "type": "string"
+                }
+            }
+        },
+        "rest.SignRepSt": {
+            "type": "object",
+            "properties": {
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "rest.SignReqSt": {
+            "type": "object",
+            "required": [
+                "path"
+            ],
+            "properties": {
+                "path": {
+                    "type": "string"
+                },
+                "query": {
+                    "description": "bound params, e.g. {\"w\": \"100\", \"h\": \"100\"}",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "ttl": {
+                    "description": "in seconds, default 1 hour",
+                    "type": "integer"
+                }
+            }
+        },
+        "types.CacheStatsSt": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "evictions": {
+                    "description": "removed by limits",
+                    "type": "integer"
+                },
+                "hits": {
+                    "type": "integer"
+                },
+                "max_count": {
+                    "description": "0 - no limit",
+                    "type": "integer"
+                },
+                "max_size": {
+                    "description": "0 - no limit",
+                    "type": "integer"
+                },
+                "misses": {
+                    "type": "integer"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "types.StaticListItemSt": {
+            "type": "object",
+            "properties": {
+                "is_dir": {
+                    "type": "boolean"
+                },
+                "is_zip_dir": {
+                    "type": "boolean"
+                },
+                "mtime": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "zip-dir path ends with \"/\"",
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "types.StaticMetaSt": {
+            "type": "object",
+            "properties": {
+                "content_type": {
+                    "type": "string"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "mtime": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "orientation": {
+                    "type": "string",
+                    "enum": [
+                        "landscape",
+                        "portrait",
+                        "square"
+                    ]
+                },
+                "original_name": {
+                    "description": "name of uploaded file, empty if unknown",
+                    "type": "string"
+                },
+                "sha256": {
+                    "description": "hex",
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "width": {
+                    "description": "only for images",
+                    "type": "integer"
                 }
             }
         }
@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	dopHttps "github.com/rendau/dop/adapters/server/https"
+	"github.com/rendau/dop/dopErrs"
+	"github.com/rendau/fs/internal/domain/errs"
+	"github.com/rendau/fs/internal/domain/types"
+)
+
+// @Router  /cache/stats [get]
+// @Tags    cache
+// @Summary Statistics of memory and disk caches.
+// @Success 200 {object} CacheStatsRepSt
+// @Failure 401 {object} dopTypes.ErrRep
+// @Failure 403 {object} dopTypes.ErrRep
+func (a *St) hCacheStats(c *gin.Context) {
+	if !a.getAuthScope(c).Admin {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
+	c.JSON(http.StatusOK, CacheStatsRepSt{
+		Memory: a.core.Cache.GetStats(),
+		Disk:   a.core.DiskCache.GetStats(),
+	})
+}
+
+// @Router  /cache/purge [post]
+// @Tags    cache
+// @Summary Purge memory and disk cache entries by key, by path prefix or all.
+// @Param   body body     CachePurgeReqSt false "body"
+// @Success 200  {object} CachePurgeRepSt
+// @Failure 400  {object} dopTypes.ErrRep
+// @Failure 401  {object} dopTypes.ErrRep
+// @Failure 403  {object} dopTypes.ErrRep
+func (a *St) hCachePurge(c *gin.Context) {
+	if !a.getAuthScope(c).Admin {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
+	reqObj := &CachePurgeReqSt{}
+	if !dopHttps.BindJSON(c, reqObj) {
+		return
+	}
+
+	repObj := CachePurgeRepSt{}
+
+	switch {
+	case reqObj.All:
+		repObj.Removed = a.core.Cache.RemoveByPrefix("") + a.core.DiskCache.RemoveByPrefix("")
+	case reqObj.Key != "":
+		if a.core.Cache.Remove(reqObj.Key) {
+			repObj.Removed = 1
+		}
+		repObj.Removed += a.core.DiskCache.Remove(reqObj.Key)
+	case reqObj.Prefix != "":
+		repObj.Removed = a.core.Cache.RemoveByPrefix(reqObj.Prefix) + a.core.DiskCache.RemoveByPrefix(reqObj.Prefix)
+	default:
+		dopHttps.Error(c, dopErrs.ErrWithDesc{Err: errs.BadFormData, Desc: "key, prefix or all is required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, repObj)
+}
+
+// @Router  /cache/warmup [post]
+// @Tags    cache
+// @Summary Create derivatives of files for presets.
+// @Param   body body     CacheWarmUpReqSt false "body"
+// @Success 200  {object} CacheWarmUpRepSt
+// @Failure 400  {object} dopTypes.ErrRep
+// @Failure 401  {object} dopTypes.ErrRep
+// @Failure 403  {object} dopTypes.ErrRep
+func (a *St) hCacheWarmUp(c *gin.Context) {
+	if !a.getAuthScope(c).Admin {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
+	reqObj := &CacheWarmUpReqSt{}
+	if !dopHttps.BindJSON(c, reqObj) {
+		return
+	}
+
+	imgParsList := map[string]*types.ImgParsSt{}
+
+	for _, name := range reqObj.Presets {
+		preset, ok := a.imgPresets[name]
+		if !ok {
+			dopHttps.Error(c, dopErrs.ErrWithDesc{Err: errs.BadImagePreset, Desc: name})
+			return
+		}
+
+		imgPars, err := preset.toImgPars()
+		if err != nil {
+			dopHttps.Error(c, err)
+			return
+		}
+
+		imgParsList[name] = imgPars
+	}
+
+	done, errors := a.core.Cache.WarmUp(reqObj.Paths, imgParsList)
+
+	repObj := CacheWarmUpRepSt{
+		Done:   done,
+		Errors: make(map[string]string, len(errors)),
+	}
+
+	for k, err := range errors {
+		repObj.Errors[k] = err.Error()
+	}
+
+	c.JSON(http.StatusOK, repObj)
+}
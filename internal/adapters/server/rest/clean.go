@@ -1,9 +1,17 @@
 package rest
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/rendau/dop/dopErrs"
 )
 
 func (a *St) hClean(c *gin.Context) {
+	if !a.getAuthScope(c).Admin {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
 	a.core.Clean.Clean(0)
 }
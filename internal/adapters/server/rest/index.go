@@ -12,11 +12,16 @@ import (
 )
 
 type St struct {
-	lg   logger.Lite
-	core *core.St
+	lg               logger.Lite
+	core             *core.St
+	imgPresets       map[string]*GetParamsSt
+	imgPresetsStrict bool
 }
 
-func GetHandler(lg logger.Lite, core *core.St, withCors bool) http.Handler {
+// GetHandler creates http-handler.
+// imgPresets - named image params in query-string format: {"thumb": "w=300&h=200&m=fit"}.
+// If imgPresetsStrict is true, images can be transformed only by presets.
+func GetHandler(lg logger.Lite, core *core.St, withCors bool, imgPresets map[string]string, imgPresetsStrict bool) http.Handler {
 	gin.SetMode(gin.ReleaseMode)
 
 	r := gin.New()
@@ -36,22 +41,50 @@ func GetHandler(lg logger.Lite, core *core.St, withCors bool) http.Handler {
 		c.DocExpansion = "none"
 	}))
 
-	s := &St{lg: lg, core: core}
+	s := &St{
+		lg:               lg,
+		core:             core,
+		imgPresets:       map[string]*GetParamsSt{},
+		imgPresetsStrict: imgPresetsStrict,
+	}
+
+	for name, query := range imgPresets {
+		pars, err := parseImgPreset(query)
+		if err != nil {
+			lg.Errorw("Fail to parse img preset", err, "name", name, "query", query)
+			continue
+		}
+
+		s.imgPresets[name] = pars
+	}
 
 	// healthcheck
 	r.GET("/healthcheck", func(c *gin.Context) { c.Status(http.StatusOK) })
 
+	// metrics
+	r.GET("/metrics", s.hMetrics)
+
 	// static
-	r.POST("/static", s.hStaticSave)
+	r.POST("/static", s.mwAuth, s.hStaticSave)
+	r.POST("/static/sign", s.mwAuth, s.hStaticSign)
 	r.GET("/static/*any", s.hStaticGet)
+	r.HEAD("/static/*any", s.hStaticGet)
+	r.DELETE("/static/*any", s.mwAuth, s.hStaticRemove)
+	r.GET("/list/*any", s.mwAuth, s.hStaticList)
+	r.GET("/meta/*any", s.hStaticMeta)
 
 	// kvs
-	r.POST("/kvs/:key", s.hKvsSet)
+	r.POST("/kvs/:key", s.mwAuth, s.hKvsSet)
 	r.GET("/kvs/:key", s.hKvsGet)
-	r.DELETE("/kvs/:key", s.hKvsRemove)
+	r.DELETE("/kvs/:key", s.mwAuth, s.hKvsRemove)
+
+	// cache
+	r.GET("/cache/stats", s.mwAuth, s.hCacheStats)
+	r.POST("/cache/purge", s.mwAuth, s.hCachePurge)
+	r.POST("/cache/warmup", s.mwAuth, s.hCacheWarmUp)
 
 	// clean
-	r.GET("/clean", s.hClean)
+	r.GET("/clean", s.mwAuth, s.hClean)
 
 	return r
 }
@@ -15,9 +15,16 @@ import (
 // @Param   key path string true "key"
 // @Success 200
 // @Failure 400 {object} dopTypes.ErrRep
+// @Failure 401 {object} dopTypes.ErrRep
+// @Failure 403 {object} dopTypes.ErrRep
 func (a *St) hKvsSet(c *gin.Context) {
 	key := c.Param("key")
 
+	if !a.getAuthScope(c).HasKvsKey(key) {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
 	err := a.core.Kvs.Set(key, c.Request.Body)
 	if dopHttps.Error(c, err) {
 		return
@@ -65,9 +72,16 @@ func (a *St) hKvsGet(c *gin.Context) {
 // @Param   key   path  string true  "key"
 // @Success 200
 // @Failure 400 {object} dopTypes.ErrRep
+// @Failure 401 {object} dopTypes.ErrRep
+// @Failure 403 {object} dopTypes.ErrRep
 func (a *St) hKvsRemove(c *gin.Context) {
 	key := c.Param("key")
 
+	if !a.getAuthScope(c).HasKvsKey(key) {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
 	err := a.core.Kvs.Remove(key)
 	if err != nil {
 		dopHttps.Error(c, err)
@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Router  /metrics [get]
+// @Tags    metrics
+// @Summary Metrics in prometheus text format.
+// @Produce plain
+// @Success 200
+func (a *St) hMetrics(c *gin.Context) {
+	sb := &strings.Builder{}
+
+	imgQueueStats := a.core.Img.GetQueueStats()
+
+	writeMetric(sb, "fs_img_concurrency", "gauge", "Max count of parallel image transformations, 0 - no limit.", int64(imgQueueStats.Concurrency))
+	writeMetric(sb, "fs_img_running", "gauge", "Image transformations in progress.", imgQueueStats.Running)
+	writeMetric(sb, "fs_img_queue_waiting", "gauge", "Image transformations waiting in queue.", imgQueueStats.Waiting)
+	writeMetric(sb, "fs_img_queue_timeouts_total", "counter", "Image transformations rejected by queue timeout.", imgQueueStats.Timeouts)
+
+	cacheStats := a.core.Cache.GetStats()
+
+	writeMetric(sb, "fs_cache_entries", "gauge", "Entries in memory cache.", int64(cacheStats.Count))
+	writeMetric(sb, "fs_cache_bytes", "gauge", "Bytes in memory cache.", cacheStats.Size)
+	writeMetric(sb, "fs_cache_hits_total", "counter", "Memory cache hits.", cacheStats.Hits)
+	writeMetric(sb, "fs_cache_misses_total", "counter", "Memory cache misses.", cacheStats.Misses)
+	writeMetric(sb, "fs_cache_evictions_total", "counter", "Memory cache entries evicted by limits.", cacheStats.Evictions)
+
+	diskCacheStats := a.core.DiskCache.GetStats()
+
+	writeMetric(sb, "fs_disk_cache_entries", "gauge", "Entries in disk cache.", int64(diskCacheStats.Count))
+	writeMetric(sb, "fs_disk_cache_bytes", "gauge", "Bytes in disk cache.", diskCacheStats.Size)
+	writeMetric(sb, "fs_disk_cache_hits_total", "counter", "Disk cache hits.", diskCacheStats.Hits)
+	writeMetric(sb, "fs_disk_cache_misses_total", "counter", "Disk cache misses.", diskCacheStats.Misses)
+	writeMetric(sb, "fs_disk_cache_evictions_total", "counter", "Disk cache entries evicted by limits.", diskCacheStats.Evictions)
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(sb.String()))
+}
+
+func writeMetric(sb *strings.Builder, name, metricType, help string, value int64) {
+	_, _ = fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, metricType, name, value)
+}
@@ -0,0 +1,37 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	dopHttps "github.com/rendau/dop/adapters/server/https"
+	"github.com/rendau/dop/dopErrs"
+	"github.com/rendau/dop/dopTypes"
+	"github.com/rendau/fs/internal/domain/types"
+)
+
+const ctxKeyAuthScope = "auth_scope"
+
+func (a *St) mwAuth(c *gin.Context) {
+	scope, err := a.core.Auth.GetScope(dopHttps.GetAuthToken(c))
+	if err != nil {
+		abortWithErr(c, http.StatusUnauthorized, dopErrs.NotAuthorized)
+		return
+	}
+
+	c.Set(ctxKeyAuthScope, scope)
+}
+
+func (a *St) getAuthScope(c *gin.Context) *types.AuthScopeSt {
+	if v, ok := c.Get(ctxKeyAuthScope); ok {
+		return v.(*types.AuthScopeSt)
+	}
+
+	return &types.AuthScopeSt{}
+}
+
+func abortWithErr(c *gin.Context, status int, err error) {
+	c.AbortWithStatusJSON(status, dopTypes.ErrRep{
+		ErrorCode: err.Error(),
+	})
+}
@@ -1,15 +1,21 @@
 package rest
 
 import (
-	"bytes"
+	"encoding/json"
+	"mime"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	dopHttps "github.com/rendau/dop/adapters/server/https"
 	"github.com/rendau/dop/dopErrs"
 	"github.com/rendau/fs/internal/domain/types"
+	"github.com/rendau/fs/internal/domain/util"
 
 	"github.com/rendau/fs/internal/domain/errs"
 )
@@ -21,6 +27,9 @@ import (
 // @Param   body body     SaveReqSt false "body"
 // @Success 200  {object} SaveRepSt
 // @Failure 400  {object} dopTypes.ErrRep
+// @Failure 401  {object} dopTypes.ErrRep
+// @Failure 403  {object} dopTypes.ErrRep
+// @Failure 503  {object} dopTypes.ErrRep
 func (a *St) hStaticSave(c *gin.Context) {
 	var err error
 
@@ -34,6 +43,26 @@ func (a *St) hStaticSave(c *gin.Context) {
 		dopHttps.Error(c, dopErrs.ErrWithDesc{Err: errs.BadFile})
 		return
 	}
+
+	authScope := a.getAuthScope(c)
+
+	if !authScope.HasDir(reqObj.Dir) {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
+	uploadMeta := &types.StaticUploadMetaSt{
+		Uploader: authScope.Id,
+	}
+
+	if reqObj.Tags != "" {
+		err = json.Unmarshal([]byte(reqObj.Tags), &uploadMeta.Tags)
+		if err != nil {
+			dopHttps.Error(c, dopErrs.ErrWithDesc{Err: errs.BadFormData, Desc: "bad tags: " + err.Error()})
+			return
+		}
+	}
+
 	f, err := reqObj.File.Open()
 	if err != nil {
 		a.lg.Errorw("Fail to open file", err)
@@ -48,7 +77,12 @@ func (a *St) hStaticSave(c *gin.Context) {
 		f,
 		reqObj.NoCut,
 		reqObj.ExtractZip,
+		uploadMeta,
 	)
+	if err == errs.ImageQueueTimeout {
+		abortWithErr(c, http.StatusServiceUnavailable, err)
+		return
+	}
 	if dopHttps.Error(c, err) {
 		return
 	}
@@ -56,7 +90,49 @@ func (a *St) hStaticSave(c *gin.Context) {
 	c.JSON(http.StatusOK, SaveRepSt{Path: result})
 }
 
+// @Router  /static/sign [post]
+// @Tags    static
+// @Summary Create signed url for file in private dir.
+// @Param   body body     SignReqSt false "body"
+// @Success 200  {object} SignRepSt
+// @Failure 400  {object} dopTypes.ErrRep
+// @Failure 401  {object} dopTypes.ErrRep
+// @Failure 403  {object} dopTypes.ErrRep
+func (a *St) hStaticSign(c *gin.Context) {
+	reqObj := &SignReqSt{}
+	if !dopHttps.BindJSON(c, reqObj) {
+		return
+	}
+
+	if !a.getAuthScope(c).HasDir(path.Dir(util.ToStoragePath(reqObj.Path))) {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
+	boundQuery := url.Values{}
+	for k, v := range reqObj.Query {
+		boundQuery.Set(k, v)
+	}
+
+	query, err := a.core.Sign.Create(reqObj.Path, time.Duration(reqObj.Ttl)*time.Second, boundQuery)
+	if dopHttps.Error(c, err) {
+		return
+	}
+
+	urlPath := util.ToUrlPath(reqObj.Path)
+
+	// zip-dir url needs trailing slash
+	if urlPath != "" && strings.HasSuffix(reqObj.Path, "/") {
+		urlPath += "/"
+	}
+
+	c.JSON(http.StatusOK, SignRepSt{
+		Url: "/static/" + urlPath + "?" + query.Encode(),
+	})
+}
+
 // @Router  /static/:path [get]
+// @Router  /static/:path [head]
 // @Tags    static
 // @Summary Get or download file.
 // @Param   path  path  string      true  "path"
@@ -64,6 +140,8 @@ func (a *St) hStaticSave(c *gin.Context) {
 // @Produce octet-stream
 // @Success 200
 // @Failure 400 {object} dopTypes.ErrRep
+// @Failure 403 {object} dopTypes.ErrRep
+// @Failure 503 {object} dopTypes.ErrRep
 func (a *St) hStaticGet(c *gin.Context) {
 	var err error
 
@@ -73,32 +151,268 @@ func (a *St) hStaticGet(c *gin.Context) {
 		urlPath = urlPath[7:]
 	}
 
+	if !a.checkPrivateAccess(c, urlPath) {
+		return
+	}
+
 	pars := &GetParamsSt{}
 	if !dopHttps.BindQuery(c, pars) {
 		return
 	}
 
-	fName, fModTime, fData, err := a.core.Static.Get(urlPath, &types.ImgParsSt{
-		Method:    pars.M,
-		Width:     pars.W,
-		Height:    pars.H,
-		Blur:      pars.Blur,
-		Grayscale: pars.Grayscale,
-	}, pars.Download != "")
+	if a.imgPresetsStrict && pars.hasCustomImgPars() {
+		dopHttps.Error(c, errs.ImagePresetRequired)
+		return
+	}
+
+	if pars.Preset != "" {
+		preset, ok := a.imgPresets[pars.Preset]
+		if !ok {
+			dopHttps.Error(c, errs.BadImagePreset)
+			return
+		}
+
+		// explicit params override preset values
+		presetPars := *preset
+		if !dopHttps.BindQuery(c, &presetPars) {
+			return
+		}
+		pars = &presetPars
+	}
+
+	imgPars, err := pars.toImgPars()
+	if err != nil {
+		dopHttps.Error(c, err)
+		return
+	}
+
+	if imgPars.Format == "" && pars.Download == "" {
+		var vary bool
+
+		imgPars.Format, vary = a.core.Img.NegotiateFormat(urlPath, c.GetHeader("Accept"))
+		if vary {
+			c.Header("Vary", "Accept")
+		}
+	}
+
+	file, err := a.core.Static.Get(urlPath, imgPars, pars.Download != "")
 	if err != nil {
 		if err == dopErrs.ObjectNotFound {
 			c.Status(http.StatusNotFound)
+		} else if err == errs.ImageQueueTimeout {
+			abortWithErr(c, http.StatusServiceUnavailable, err)
 		} else {
 			dopHttps.Error(c, err)
 		}
 		return
 	}
+	defer file.Close()
 
 	if pars.Download != "" {
-		pars.Download += path.Ext(fName)
+		pars.Download += path.Ext(file.Name)
 		c.Header("Content-Type", `application/octet-stream`)
 		c.Header("Content-Disposition", `attachment; filename="`+pars.Download+`"`)
+	} else if file.OriginalName != "" {
+		// extension follows the served file, it changes on format conversion
+		fileName := strings.TrimSuffix(file.OriginalName, path.Ext(file.OriginalName)) + path.Ext(file.Name)
+		c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": fileName}))
+	}
+
+	if file.WriteTo != nil {
+		if c.Writer.Header().Get("Content-Type") == "" {
+			c.Header("Content-Type", mime.TypeByExtension(path.Ext(file.Name)))
+		}
+
+		c.Status(http.StatusOK)
+
+		if c.Request.Method != http.MethodHead {
+			_ = file.WriteTo(c.Writer) // errors are logged in core
+		}
+
+		return
+	}
+
+	http.ServeContent(c.Writer, c.Request, file.Name, file.ModTime, file.Content)
+}
+
+// @Router  /meta/:path [get]
+// @Tags    static
+// @Summary Get metadata of file.
+// @Param   path path string true "path"
+// @Success 200 {object} types.StaticMetaSt
+// @Failure 403 {object} dopTypes.ErrRep
+// @Failure 404
+// @Failure 503 {object} dopTypes.ErrRep
+func (a *St) hStaticMeta(c *gin.Context) {
+	urlPath := strings.TrimPrefix(c.Request.URL.Path, "/meta")
+
+	if !a.checkPrivateAccess(c, urlPath) {
+		return
+	}
+
+	result, err := a.core.Static.GetMeta(urlPath)
+	if err != nil {
+		if err == dopErrs.ObjectNotFound {
+			c.Status(http.StatusNotFound)
+		} else if err == errs.ImageQueueTimeout {
+			abortWithErr(c, http.StatusServiceUnavailable, err)
+		} else {
+			dopHttps.Error(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// @Router  /list/:path [get]
+// @Tags    static
+// @Summary List entries of dir.
+// @Param   path  path  string    true  "path"
+// @Param   query query ListReqSt false "query"
+// @Success 200 {object} ListRepSt
+// @Failure 400 {object} dopTypes.ErrRep
+// @Failure 401 {object} dopTypes.ErrRep
+// @Failure 403 {object} dopTypes.ErrRep
+// @Failure 404
+func (a *St) hStaticList(c *gin.Context) {
+	urlPath := util.ToUrlPath(strings.TrimPrefix(c.Request.URL.Path, "/list"))
+
+	authScope := a.getAuthScope(c)
+
+	if !authScope.HasDir(util.ToStoragePath(urlPath)) {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
+	// signed urls are per file, so entries of private dirs are listed only for admin
+	if a.core.Sign.IsPrivate(urlPath) && !authScope.Admin {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
+	reqObj := &ListReqSt{}
+	if !dopHttps.BindQuery(c, reqObj) {
+		return
+	}
+
+	pars := &types.StaticListParsSt{
+		Page:     reqObj.Page,
+		PageSize: reqObj.PageSize,
+		SortName: reqObj.SortName,
+		SortDesc: reqObj.SortDesc,
+	}
+
+	items, totalCount, err := a.core.Static.List(urlPath, pars)
+	if err == dopErrs.ObjectNotFound {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if dopHttps.Error(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, ListRepSt{
+		Page:       pars.Page,
+		PageSize:   pars.PageSize,
+		TotalCount: totalCount,
+		Results:    items,
+	})
+}
+
+// @Router  /static/:path [delete]
+// @Tags    static
+// @Summary Remove file or zip-dir.
+// @Param   path path string true "path"
+// @Success 200
+// @Failure 400 {object} dopTypes.ErrRep
+// @Failure 401 {object} dopTypes.ErrRep
+// @Failure 403 {object} dopTypes.ErrRep
+// @Failure 404
+func (a *St) hStaticRemove(c *gin.Context) {
+	urlPath := util.ToUrlPath(strings.TrimPrefix(c.Request.URL.Path, "/static"))
+
+	if !a.getAuthScope(c).HasDir(path.Dir(util.ToStoragePath(urlPath))) {
+		abortWithErr(c, http.StatusForbidden, dopErrs.PermissionDenied)
+		return
+	}
+
+	err := a.core.Static.Remove(urlPath)
+	if err == dopErrs.ObjectNotFound {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if dopHttps.Error(c, err) {
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// checkPrivateAccess checks signature of url for files in private dirs
+func (a *St) checkPrivateAccess(c *gin.Context, urlPath string) bool {
+	if !a.core.Sign.IsPrivate(urlPath) {
+		return true
+	}
+
+	err := a.core.Sign.Check(urlPath, c.Request.URL.Query())
+	if err != nil {
+		abortWithErr(c, http.StatusForbidden, err)
+		return false
+	}
+
+	c.Header("Cache-Control", "private")
+
+	return true
+}
+
+// parseImgCrop parses "x,y,w,h"
+func parseImgCrop(v string) (types.ImgCropSt, error) {
+	result := types.ImgCropSt{}
+
+	if v == "" {
+		return result, nil
+	}
+
+	parts := strings.Split(v, ",")
+	if len(parts) != 4 {
+		return result, errs.BadImageCrop
+	}
+
+	values := make([]int, len(parts))
+
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return result, errs.BadImageCrop
+		}
+		values[i] = n
+	}
+
+	result.X, result.Y, result.Width, result.Height = values[0], values[1], values[2], values[3]
+
+	if result.Width <= 0 || result.Height <= 0 {
+		return result, errs.BadImageCrop
+	}
+
+	return result, nil
+}
+
+func parseImgPreset(query string) (*GetParamsSt, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
 	}
 
-	http.ServeContent(c.Writer, c.Request, fName, fModTime, bytes.NewReader(fData))
+	result := &GetParamsSt{}
+
+	err = binding.MapFormWithTag(result, values, "form")
+	if err != nil {
+		return nil, err
+	}
+
+	result.Preset = ""
+	result.Download = ""
+
+	return result, nil
 }
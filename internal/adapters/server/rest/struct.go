@@ -2,6 +2,8 @@ package rest
 
 import (
 	"mime/multipart"
+
+	"github.com/rendau/fs/internal/domain/types"
 )
 
 type SaveReqSt struct {
@@ -9,17 +11,116 @@ type SaveReqSt struct {
 	File       *multipart.FileHeader `json:"file" form:"file" binding:"required" swaggertype:"string"`
 	NoCut      bool                  `json:"no_cut" form:"no_cut"`
 	ExtractZip bool                  `json:"extract_zip" form:"extract_zip"`
+	Tags       string                `json:"tags" form:"tags"` // json object of strings, e.g. {"owner": "123"}
 }
 
 type SaveRepSt struct {
 	Path string `json:"path"`
 }
 
+type SignReqSt struct {
+	Path  string            `json:"path" binding:"required"`
+	Ttl   int64             `json:"ttl"`   // in seconds, default 1 hour
+	Query map[string]string `json:"query"` // bound params, e.g. {"w": "100", "h": "100"}
+}
+
+type SignRepSt struct {
+	Url string `json:"url"`
+}
+
+type ListReqSt struct {
+	Page     int64  `json:"page" form:"page"`           // from 0
+	PageSize int64  `json:"page_size" form:"page_size"` // default 100, max 1000
+	SortName string `json:"sort_name" form:"sort_name" enums:"name,size,mtime"`
+	SortDesc bool   `json:"sort_desc" form:"sort_desc"`
+}
+
+type ListRepSt struct {
+	Page       int64                     `json:"page"`
+	PageSize   int64                     `json:"page_size"`
+	TotalCount int64                     `json:"total_count"`
+	Results    []*types.StaticListItemSt `json:"results"`
+}
+
 type GetParamsSt struct {
-	W         int     `json:"w" form:"w"`
-	H         int     `json:"h" form:"h"`
-	M         string  `json:"m" form:"m"`
-	Blur      float64 `json:"blur" form:"blur"`
-	Grayscale bool    `json:"grayscale" form:"grayscale"`
-	Download  string  `json:"download" form:"download"`
+	Preset     string  `json:"preset" form:"preset"`
+	W          int     `json:"w" form:"w"`
+	H          int     `json:"h" form:"h"`
+	M          string  `json:"m" form:"m" enums:"fill,fit,pad"`
+	Bg         string  `json:"bg" form:"bg"` // hex background color for "pad" method, default: transparent (white for jpeg)
+	G          string  `json:"g" form:"g" enums:"center,north,south,east,west,north-east,north-west,south-east,south-west"`
+	Crop       string  `json:"crop" form:"crop"`                        // "x,y,w,h" in source image pixels
+	Rotate     int     `json:"rotate" form:"rotate" enums:"90,180,270"` // clockwise
+	Flip       string  `json:"flip" form:"flip" enums:"h,v,hv"`
+	Blur       float64 `json:"blur" form:"blur"`
+	Sharpen    float64 `json:"sharpen" form:"sharpen"`
+	Grayscale  bool    `json:"grayscale" form:"grayscale"`
+	Brightness float64 `json:"brightness" form:"brightness"` // -100..100
+	Contrast   float64 `json:"contrast" form:"contrast"`     // -100..100
+	Gamma      float64 `json:"gamma" form:"gamma"`           // 1 - no changes
+	Saturation float64 `json:"saturation" form:"saturation"` // -100..500
+	Fmt        string  `json:"fmt" form:"fmt" enums:"jpeg,png,webp"`
+	Q          int     `json:"q" form:"q"` // jpeg/webp quality or png compression (1-100)
+	Download   string  `json:"download" form:"download"`
+}
+
+func (o *GetParamsSt) toImgPars() (*types.ImgParsSt, error) {
+	imgCrop, err := parseImgCrop(o.Crop)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.ImgParsSt{
+		Method:     o.M,
+		Gravity:    o.G,
+		Width:      o.W,
+		Height:     o.H,
+		Crop:       imgCrop,
+		BgColor:    o.Bg,
+		Rotate:     o.Rotate,
+		Flip:       o.Flip,
+		Blur:       o.Blur,
+		Sharpen:    o.Sharpen,
+		Grayscale:  o.Grayscale,
+		Brightness: o.Brightness,
+		Contrast:   o.Contrast,
+		Gamma:      o.Gamma,
+		Saturation: o.Saturation,
+		Format:     o.Fmt,
+		Quality:    o.Q,
+	}, nil
+}
+
+// hasCustomImgPars checks if any image param is set, except allowed in strict presets mode
+func (o GetParamsSt) hasCustomImgPars() bool {
+	o.Preset = ""
+	o.Fmt = ""
+	o.Download = ""
+
+	return o != GetParamsSt{}
+}
+
+type CacheStatsRepSt struct {
+	Memory *types.CacheStatsSt `json:"memory"`
+	Disk   *types.CacheStatsSt `json:"disk"`
+}
+
+type CachePurgeReqSt struct {
+	Key    string `json:"key"`    // exact cache-key
+	Prefix string `json:"prefix"` // path of file or dir
+	All    bool   `json:"all"`
+}
+
+type CachePurgeRepSt struct {
+	Removed int `json:"removed"` // count of removed memory and disk cache entries
+}
+
+type CacheWarmUpReqSt struct {
+	Paths   []string `json:"paths" binding:"required"`
+	Presets []string `json:"presets" binding:"required"`
+}
+
+type CacheWarmUpRepSt struct {
+	Done   int               `json:"done"`
+	Errors map[string]string `json:"errors"` // "path?preset" (or "path?preset&format=webp" for auto format) -> error
 }
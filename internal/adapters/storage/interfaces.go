@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"io"
+)
+
+// Storage works with slash-separated paths relative to the storage root.
+// Missing objects must be reported with fs.ErrNotExist.
+type Storage interface {
+	Put(p string, r io.Reader) error
+	Get(p string) (io.ReadSeekCloser, error)
+	Stat(p string) (*FileInfoSt, error)
+	List(p string) ([]*FileInfoSt, error)
+	// Remove removes file or directory with all its content
+	Remove(p string) error
+	// RemoveDir removes directory only if it is empty (atomically), non-empty directory must be reported with fs.ErrExist
+	RemoveDir(p string) error
+	// Rename moves file from p to newP (replaces existing one), so complete file appears at newP at once
+	Rename(p string, newP string) error
+	Walk(p string, fn WalkFunc) error
+}
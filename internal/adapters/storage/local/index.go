@@ -0,0 +1,151 @@
+package local
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rendau/fs/internal/adapters/storage"
+)
+
+type St struct {
+	dirPath string
+}
+
+func New(dirPath string) *St {
+	return &St{
+		dirPath: dirPath,
+	}
+}
+
+func (s *St) Put(p string, r io.Reader) error {
+	absPath := s.absPath(p)
+
+	err := os.MkdirAll(filepath.Dir(absPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(absPath)
+	if os.IsNotExist(err) {
+		// dir was removed by concurrent RemoveDir as empty
+		if err = os.MkdirAll(filepath.Dir(absPath), os.ModePerm); err == nil {
+			f, err = os.Create(absPath)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *St) Get(p string) (io.ReadSeekCloser, error) {
+	f, err := os.Open(s.absPath(p))
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *St) Stat(p string) (*storage.FileInfoSt, error) {
+	info, err := os.Stat(s.absPath(p))
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfoFromOs(info), nil
+}
+
+func (s *St) List(p string) ([]*storage.FileInfoSt, error) {
+	entries, err := os.ReadDir(s.absPath(p))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*storage.FileInfoSt, 0, len(entries))
+
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		result = append(result, fileInfoFromOs(info))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+func (s *St) Remove(p string) error {
+	return os.RemoveAll(s.absPath(p))
+}
+
+func (s *St) RemoveDir(p string) error {
+	// non-empty dir error (ENOTEMPTY) matches fs.ErrExist
+	return os.Remove(s.absPath(p))
+}
+
+func (s *St) Rename(p string, newP string) error {
+	absNewPath := s.absPath(newP)
+
+	err := os.MkdirAll(filepath.Dir(absNewPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(s.absPath(p), absNewPath)
+}
+
+func (s *St) Walk(p string, fn storage.WalkFunc) error {
+	rootPath := s.absPath(p)
+
+	if _, err := os.Stat(rootPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(rootPath, func(absPath string, info os.FileInfo, err error) error {
+		if absPath == rootPath && err == nil {
+			return nil
+		}
+
+		relPath, rErr := filepath.Rel(s.dirPath, absPath)
+		if rErr != nil {
+			return rErr
+		}
+
+		var fInfo *storage.FileInfoSt
+		if info != nil {
+			fInfo = fileInfoFromOs(info)
+		}
+
+		return fn(filepath.ToSlash(relPath), fInfo, err)
+	})
+}
+
+func (s *St) absPath(p string) string {
+	return filepath.Join(s.dirPath, filepath.FromSlash(p))
+}
+
+func fileInfoFromOs(info fs.FileInfo) *storage.FileInfoSt {
+	return &storage.FileInfoSt{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+}
@@ -0,0 +1,209 @@
+package mem
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rendau/fs/internal/adapters/storage"
+)
+
+type St struct {
+	files map[string]*fileSt
+	mu    sync.RWMutex
+}
+
+type fileSt struct {
+	data []byte
+	mt   time.Time
+}
+
+func New() *St {
+	return &St{
+		files: map[string]*fileSt{},
+	}
+}
+
+func (s *St) Put(p string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[normalize(p)] = &fileSt{data: data, mt: time.Now()}
+
+	return nil
+}
+
+func (s *St) Get(p string) (io.ReadSeekCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.files[normalize(p)]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	return storage.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (s *St) Stat(p string) (*storage.FileInfoSt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p = normalize(p)
+
+	if f, ok := s.files[p]; ok {
+		return f.info(p), nil
+	}
+
+	var dirInfo *storage.FileInfoSt
+
+	for k, f := range s.files {
+		if p == "" || strings.HasPrefix(k, p+"/") {
+			if dirInfo == nil {
+				dirInfo = &storage.FileInfoSt{Name: baseName(p), IsDir: true}
+			}
+			if f.mt.After(dirInfo.ModTime) {
+				dirInfo.ModTime = f.mt
+			}
+		}
+	}
+
+	if dirInfo == nil {
+		return nil, fs.ErrNotExist
+	}
+
+	return dirInfo, nil
+}
+
+func (s *St) List(p string) ([]*storage.FileInfoSt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p = normalize(p)
+
+	prefix := ""
+	if p != "" {
+		prefix = p + "/"
+	}
+
+	items := map[string]*storage.FileInfoSt{}
+
+	for k, f := range s.files {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		rel := k[len(prefix):]
+
+		if i := strings.Index(rel, "/"); i > -1 {
+			name := rel[:i]
+			item, ok := items[name]
+			if !ok {
+				item = &storage.FileInfoSt{Name: name, IsDir: true}
+				items[name] = item
+			}
+			if f.mt.After(item.ModTime) {
+				item.ModTime = f.mt
+			}
+		} else {
+			items[rel] = f.info(k)
+		}
+	}
+
+	if len(items) == 0 && p != "" {
+		return nil, fs.ErrNotExist
+	}
+
+	result := make([]*storage.FileInfoSt, 0, len(items))
+	for _, item := range items {
+		result = append(result, item)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+func (s *St) Remove(p string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p = normalize(p)
+
+	for k := range s.files {
+		if p == "" || k == p || strings.HasPrefix(k, p+"/") {
+			delete(s.files, k)
+		}
+	}
+
+	return nil
+}
+
+// RemoveDir only checks for emptiness, directories are not stored
+func (s *St) RemoveDir(p string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p = normalize(p)
+
+	for k := range s.files {
+		if p == "" || strings.HasPrefix(k, p+"/") {
+			return fs.ErrExist
+		}
+	}
+
+	return nil
+}
+
+func (s *St) Rename(p string, newP string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p = normalize(p)
+
+	f, ok := s.files[p]
+	if !ok {
+		return fs.ErrNotExist
+	}
+
+	delete(s.files, p)
+	s.files[normalize(newP)] = f
+
+	return nil
+}
+
+func (s *St) Walk(p string, fn storage.WalkFunc) error {
+	s.mu.RLock()
+	files := make(map[string]*storage.FileInfoSt, len(s.files))
+	for k, f := range s.files {
+		files[k] = f.info(k)
+	}
+	s.mu.RUnlock()
+
+	return storage.WalkFlat(normalize(p), files, fn)
+}
+
+func (f *fileSt) info(p string) *storage.FileInfoSt {
+	return &storage.FileInfoSt{
+		Name:    baseName(p),
+		Size:    int64(len(f.data)),
+		ModTime: f.mt,
+	}
+}
+
+func normalize(p string) string {
+	return strings.Trim(p, "/")
+}
+
+func baseName(p string) string {
+	return p[strings.LastIndex(p, "/")+1:]
+}
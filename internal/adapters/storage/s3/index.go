@@ -0,0 +1,307 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rendau/fs/internal/adapters/storage"
+)
+
+const (
+	defaultRegion = "us-east-1"
+	partSize      = 16 * 1024 * 1024
+)
+
+type St struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func New(endpoint, accessKey, secretKey, region, bucket, prefix string, useSsl bool) (*St, error) {
+	if region == "" {
+		region = defaultRegion
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSsl,
+		Region: region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &St{
+		client: client,
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+	}, nil
+}
+
+func (s *St) Put(p string, r io.Reader) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.key(p), r, readerSize(r), minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension(path.Ext(p)),
+		PartSize:    partSize,
+	})
+
+	return err
+}
+
+func (s *St) Get(p string) (io.ReadSeekCloser, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, s.key(p), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, convertErr(err)
+	}
+
+	// object is lazy, stat forces the request to check existence
+	_, err = obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		return nil, convertErr(err)
+	}
+
+	return obj, nil
+}
+
+func (s *St) Stat(p string) (*storage.FileInfoSt, error) {
+	key := s.key(p)
+
+	if key != s.prefix {
+		info, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+		if err == nil {
+			return &storage.FileInfoSt{
+				Name:    path.Base(key),
+				Size:    info.Size,
+				ModTime: info.LastModified,
+			}, nil
+		}
+
+		if err = convertErr(err); err != fs.ErrNotExist {
+			return nil, err
+		}
+	}
+
+	// may be a "directory"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.dirKey(p),
+		Recursive: true,
+		MaxKeys:   1,
+	}) {
+		if obj.Err != nil {
+			return nil, convertErr(obj.Err)
+		}
+
+		return &storage.FileInfoSt{
+			Name:    path.Base(key),
+			ModTime: obj.LastModified,
+			IsDir:   true,
+		}, nil
+	}
+
+	if key == s.prefix {
+		return &storage.FileInfoSt{Name: path.Base(key), IsDir: true}, nil
+	}
+
+	return nil, fs.ErrNotExist
+}
+
+func (s *St) List(p string) ([]*storage.FileInfoSt, error) {
+	dirKey := s.dirKey(p)
+
+	result := make([]*storage.FileInfoSt, 0)
+
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+		Prefix: dirKey,
+	}) {
+		if obj.Err != nil {
+			return nil, convertErr(obj.Err)
+		}
+
+		name := strings.TrimPrefix(obj.Key, dirKey)
+
+		if strings.HasSuffix(name, "/") {
+			result = append(result, &storage.FileInfoSt{
+				Name:  strings.TrimSuffix(name, "/"),
+				IsDir: true,
+			})
+		} else if name != "" {
+			result = append(result, &storage.FileInfoSt{
+				Name:    name,
+				Size:    obj.Size,
+				ModTime: obj.LastModified,
+			})
+		}
+	}
+
+	if len(result) == 0 && s.key(p) != s.prefix {
+		return nil, fs.ErrNotExist
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+func (s *St) Remove(p string) error {
+	key := s.key(p)
+
+	objectsCh := make(chan minio.ObjectInfo)
+
+	// written by listing goroutine, read after RemoveObjects is drained (objectsCh is closed)
+	var listErr error
+
+	go func() {
+		defer close(objectsCh)
+
+		if key != s.prefix {
+			objectsCh <- minio.ObjectInfo{Key: key}
+		}
+
+		for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+			Prefix:    s.dirKey(p),
+			Recursive: true,
+		}) {
+			if obj.Err != nil {
+				listErr = convertErr(obj.Err)
+				return
+			}
+
+			objectsCh <- obj
+		}
+	}()
+
+	var err error
+
+	for rErr := range s.client.RemoveObjects(context.Background(), s.bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		if cErr := convertErr(rErr.Err); cErr != fs.ErrNotExist && err == nil {
+			err = cErr
+		}
+	}
+
+	if listErr != nil && err == nil {
+		err = listErr
+	}
+
+	return err
+}
+
+// RemoveDir only checks for emptiness, "directories" are key prefixes
+func (s *St) RemoveDir(p string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.dirKey(p),
+		Recursive: true,
+		MaxKeys:   1,
+	}) {
+		if obj.Err != nil {
+			return convertErr(obj.Err)
+		}
+
+		return fs.ErrExist
+	}
+
+	return nil
+}
+
+// Rename copies object on server side and removes source, objects larger than 5GB are not supported
+func (s *St) Rename(p string, newP string) error {
+	_, err := s.client.CopyObject(context.Background(), minio.CopyDestOptions{
+		Bucket: s.bucket,
+		Object: s.key(newP),
+	}, minio.CopySrcOptions{
+		Bucket: s.bucket,
+		Object: s.key(p),
+	})
+	if err != nil {
+		return convertErr(err)
+	}
+
+	return convertErr(s.client.RemoveObject(context.Background(), s.bucket, s.key(p), minio.RemoveObjectOptions{}))
+}
+
+func (s *St) Walk(p string, fn storage.WalkFunc) error {
+	files := map[string]*storage.FileInfoSt{}
+
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.dirKey(p),
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return convertErr(obj.Err)
+		}
+
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+
+		relKey := strings.TrimPrefix(strings.TrimPrefix(obj.Key, s.prefix), "/")
+
+		files[relKey] = &storage.FileInfoSt{
+			Name:    path.Base(relKey),
+			Size:    obj.Size,
+			ModTime: obj.LastModified,
+		}
+	}
+
+	return storage.WalkFlat(p, files, fn)
+}
+
+func (s *St) key(p string) string {
+	return strings.Trim(path.Join(s.prefix, p), "/")
+}
+
+func (s *St) dirKey(p string) string {
+	if key := s.key(p); key != "" {
+		return key + "/"
+	}
+	return ""
+}
+
+func convertErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return fs.ErrNotExist
+	}
+
+	return err
+}
+
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case io.Seeker:
+		cur, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		_, err = v.Seek(cur, io.SeekStart)
+		if err != nil {
+			return -1
+		}
+		return end - cur
+	}
+
+	return -1
+}
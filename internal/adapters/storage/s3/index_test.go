@@ -0,0 +1,496 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rendau/fs/internal/adapters/storage"
+	"github.com/stretchr/testify/require"
+)
+
+const testBucket = "test-bucket"
+
+// fakeS3 is a minimal in-process S3 server (path-style, single bucket, no auth checks)
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]*fakeObjectSt
+	uploads map[string]map[int][]byte
+	seq     int
+	listErr string // error code for list requests, to emulate failures
+}
+
+type fakeObjectSt struct {
+	data []byte
+	mt   time.Time
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: map[string]*fakeObjectSt{},
+		uploads: map[string]map[int][]byte{},
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if pathParts[0] != testBucket {
+		f.writeErr(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	query := r.URL.Query()
+
+	if len(pathParts) < 2 || pathParts[1] == "" {
+		switch {
+		case r.Method == http.MethodGet && query.Get("list-type") == "2":
+			f.mu.Lock()
+			listErr := f.listErr
+			f.mu.Unlock()
+
+			if listErr != "" {
+				f.writeErr(w, http.StatusForbidden, listErr)
+				return
+			}
+
+			f.list(w, query)
+		case r.Method == http.MethodPost && query.Has("delete"):
+			f.deleteMulti(w, r)
+		default:
+			f.writeErr(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+
+	key := pathParts[1]
+
+	switch r.Method {
+	case http.MethodPut:
+		if copySource := r.Header.Get("X-Amz-Copy-Source"); copySource != "" {
+			srcKey, _ := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(copySource, "/"), testBucket+"/"))
+
+			f.mu.Lock()
+			obj, ok := f.objects[srcKey]
+			if ok {
+				f.objects[key] = &fakeObjectSt{data: obj.data, mt: time.Now()}
+			}
+			f.mu.Unlock()
+
+			if !ok {
+				f.writeErr(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+
+			writeXml(w, struct {
+				XMLName      xml.Name `xml:"CopyObjectResult"`
+				ETag         string
+				LastModified string
+			}{ETag: etag(obj.data), LastModified: time.Now().UTC().Format(time.RFC3339)})
+			return
+		}
+
+		data, err := readBody(r)
+		if err != nil {
+			f.writeErr(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+
+		f.mu.Lock()
+		if uploadId := query.Get("uploadId"); uploadId != "" {
+			partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+			f.uploads[uploadId][partNumber] = data
+		} else {
+			f.objects[key] = &fakeObjectSt{data: data, mt: time.Now()}
+		}
+		f.mu.Unlock()
+
+		w.Header().Set("ETag", etag(data))
+	case http.MethodPost:
+		if query.Has("uploads") {
+			f.mu.Lock()
+			f.seq++
+			uploadId := strconv.Itoa(f.seq)
+			f.uploads[uploadId] = map[int][]byte{}
+			f.mu.Unlock()
+
+			writeXml(w, struct {
+				XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+				Bucket   string
+				Key      string
+				UploadId string
+			}{Bucket: testBucket, Key: key, UploadId: uploadId})
+			return
+		}
+
+		req := struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}{}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.writeErr(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+
+		f.mu.Lock()
+		data := new(bytes.Buffer)
+		for _, p := range req.Parts {
+			data.Write(f.uploads[query.Get("uploadId")][p.PartNumber])
+		}
+		delete(f.uploads, query.Get("uploadId"))
+		f.objects[key] = &fakeObjectSt{data: data.Bytes(), mt: time.Now()}
+		f.mu.Unlock()
+
+		writeXml(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: testBucket, Key: key, ETag: etag(data.Bytes())})
+	case http.MethodDelete:
+		f.mu.Lock()
+		delete(f.uploads, query.Get("uploadId"))
+		if query.Get("uploadId") == "" {
+			delete(f.objects, key)
+		}
+		f.mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet, http.MethodHead:
+		f.mu.Lock()
+		obj, ok := f.objects[key]
+		f.mu.Unlock()
+
+		if !ok {
+			f.writeErr(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		w.Header().Set("ETag", etag(obj.data))
+		http.ServeContent(w, r, key, obj.mt, bytes.NewReader(obj.data))
+	default:
+		f.writeErr(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+
+	type contentSt struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+
+	type prefixSt struct {
+		Prefix string
+	}
+
+	rep := struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		KeyCount       int
+		MaxKeys        int
+		Delimiter      string
+		IsTruncated    bool
+		Contents       []contentSt
+		CommonPrefixes []prefixSt
+	}{Name: testBucket, Prefix: prefix, MaxKeys: 1000, Delimiter: delimiter}
+
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.objects))
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	seenPrefixes := map[string]bool{}
+
+	for _, k := range keys {
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i > -1 {
+				cp := k[:len(prefix)+i+len(delimiter)]
+				if !seenPrefixes[cp] {
+					seenPrefixes[cp] = true
+					rep.CommonPrefixes = append(rep.CommonPrefixes, prefixSt{Prefix: cp})
+				}
+				continue
+			}
+		}
+
+		obj := f.objects[k]
+
+		rep.Contents = append(rep.Contents, contentSt{
+			Key:          k,
+			LastModified: obj.mt.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         etag(obj.data),
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	f.mu.Unlock()
+
+	rep.KeyCount = len(rep.Contents) + len(rep.CommonPrefixes)
+
+	writeXml(w, rep)
+}
+
+func (f *fakeS3) deleteMulti(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}{}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.writeErr(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	type deletedSt struct {
+		Key string
+	}
+
+	rep := struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+		Deleted []deletedSt
+	}{}
+
+	f.mu.Lock()
+	for _, obj := range req.Objects {
+		delete(f.objects, obj.Key)
+		rep.Deleted = append(rep.Deleted, deletedSt{Key: obj.Key})
+	}
+	f.mu.Unlock()
+
+	writeXml(w, rep)
+}
+
+func (f *fakeS3) writeErr(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+func writeXml(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// readBody reads request body, decoding aws-chunked (streaming signature) payloads
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	result := new(bytes.Buffer)
+	br := bufio.NewReader(r.Body)
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		sizeHex := strings.TrimSpace(strings.SplitN(line, ";", 2)[0])
+
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			return result.Bytes(), nil
+		}
+
+		_, err = io.CopyN(result, br, size)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = br.Discard(2) // \r\n
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func newTestStorage(t *testing.T, prefix string) *St {
+	srv := httptest.NewServer(newFakeS3())
+	t.Cleanup(srv.Close)
+
+	st, err := New(strings.TrimPrefix(srv.URL, "http://"), "access", "secret", "", testBucket, prefix, false)
+	require.Nil(t, err)
+
+	return st
+}
+
+func readAll(t *testing.T, st *St, p string) string {
+	f, err := st.Get(p)
+	require.Nil(t, err)
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	require.Nil(t, err)
+
+	return string(data)
+}
+
+func TestStorage(t *testing.T) {
+	st := newTestStorage(t, "pfx/")
+
+	err := st.Put("a/b/c.txt", bytes.NewBufferString("c content"))
+	require.Nil(t, err)
+
+	// unknown size - multipart upload
+	err = st.Put("a/d.txt", io.MultiReader(strings.NewReader("d content")))
+	require.Nil(t, err)
+
+	err = st.Put("e.txt", strings.NewReader("e content"))
+	require.Nil(t, err)
+
+	require.Equal(t, "c content", readAll(t, st, "a/b/c.txt"))
+	require.Equal(t, "d content", readAll(t, st, "a/d.txt"))
+	require.Equal(t, "e content", readAll(t, st, "/e.txt"))
+
+	f, err := st.Get("a/b/c.txt")
+	require.Nil(t, err)
+	_, err = f.Seek(2, io.SeekStart)
+	require.Nil(t, err)
+	data, err := io.ReadAll(f)
+	require.Nil(t, err)
+	require.Equal(t, "content", string(data))
+	require.Nil(t, f.Close())
+
+	_, err = st.Get("a/x.txt")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	info, err := st.Stat("a/d.txt")
+	require.Nil(t, err)
+	require.False(t, info.IsDir)
+	require.Equal(t, "d.txt", info.Name)
+	require.Equal(t, int64(9), info.Size)
+
+	info, err = st.Stat("a/b")
+	require.Nil(t, err)
+	require.True(t, info.IsDir)
+	require.Equal(t, "b", info.Name)
+
+	info, err = st.Stat("")
+	require.Nil(t, err)
+	require.True(t, info.IsDir)
+
+	_, err = st.Stat("a/x")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	items, err := st.List("")
+	require.Nil(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, "a", items[0].Name)
+	require.True(t, items[0].IsDir)
+	require.Equal(t, "e.txt", items[1].Name)
+	require.False(t, items[1].IsDir)
+
+	items, err = st.List("a")
+	require.Nil(t, err)
+	require.Len(t, items, 2)
+
+	_, err = st.List("x")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	var walked []string
+
+	err = st.Walk("", func(p string, info *storage.FileInfoSt, err error) error {
+		require.Nil(t, err)
+		walked = append(walked, p)
+		if p == "a/b" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"a", "a/b", "a/d.txt", "e.txt"}, walked)
+
+	require.True(t, errors.Is(st.RemoveDir("a"), fs.ErrExist))
+
+	err = st.Rename("e.txt", "a/e.txt")
+	require.Nil(t, err)
+	require.Equal(t, "e content", readAll(t, st, "a/e.txt"))
+	_, err = st.Stat("e.txt")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	err = st.Rename("a/e.txt", "e.txt")
+	require.Nil(t, err)
+	require.Equal(t, "c content", readAll(t, st, "a/b/c.txt"))
+
+	err = st.Remove("a")
+	require.Nil(t, err)
+
+	require.Nil(t, st.RemoveDir("a"))
+
+	_, err = st.Stat("a/b/c.txt")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+	_, err = st.Stat("a")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	require.Equal(t, "e content", readAll(t, st, "e.txt"))
+
+	err = st.Remove("e.txt")
+	require.Nil(t, err)
+
+	items, err = st.List("")
+	require.Nil(t, err)
+	require.Len(t, items, 0)
+}
+
+func TestRemoveListErr(t *testing.T) {
+	fake := newFakeS3()
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	st, err := New(strings.TrimPrefix(srv.URL, "http://"), "access", "secret", "", testBucket, "", false)
+	require.Nil(t, err)
+
+	err = st.Put("a/b.txt", bytes.NewBufferString("b content"))
+	require.Nil(t, err)
+
+	fake.mu.Lock()
+	fake.listErr = "AccessDenied"
+	fake.mu.Unlock()
+
+	// content of "a" is not listed, so it is not removed
+	err = st.Remove("a")
+	require.NotNil(t, err)
+
+	fake.mu.Lock()
+	fake.listErr = ""
+	fake.mu.Unlock()
+
+	require.Equal(t, "b content", readAll(t, st, "a/b.txt"))
+}
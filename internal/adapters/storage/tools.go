@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// WalkFlat walks over a flat set of file objects (keyed by full path),
+// synthesizing directories from path segments. Directory mod-time is the newest mod-time of its files.
+func WalkFlat(root string, files map[string]*FileInfoSt, fn WalkFunc) error {
+	root = strings.Trim(root, "/")
+
+	rootPrefix := ""
+	if root != "" {
+		rootPrefix = root + "/"
+	}
+
+	keys := make([]string, 0, len(files))
+	dirs := map[string]*FileInfoSt{}
+
+	for k, v := range files {
+		if !strings.HasPrefix(k, rootPrefix) {
+			continue
+		}
+
+		keys = append(keys, k)
+
+		for d := parentDir(k); len(d) > len(root); d = parentDir(d) {
+			if dInfo, ok := dirs[d]; ok {
+				if v.ModTime.After(dInfo.ModTime) {
+					dInfo.ModTime = v.ModTime
+				}
+			} else {
+				dirs[d] = &FileInfoSt{
+					Name:    baseName(d),
+					ModTime: v.ModTime,
+					IsDir:   true,
+				}
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	visitedDirs := map[string]bool{}
+	var skipPrefixes []string
+
+	isSkipped := func(p string) bool {
+		for _, sp := range skipPrefixes {
+			if strings.HasPrefix(p, sp) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, k := range keys {
+		if isSkipped(k) {
+			continue
+		}
+
+		// visit not yet visited parent dirs, from top to bottom
+		var newDirs []string
+		for d := parentDir(k); len(d) > len(root) && !visitedDirs[d]; d = parentDir(d) {
+			newDirs = append(newDirs, d)
+		}
+
+		skipped := false
+
+		for i := len(newDirs) - 1; i >= 0; i-- {
+			d := newDirs[i]
+
+			visitedDirs[d] = true
+
+			err := fn(d, dirs[d], nil)
+			if err != nil {
+				if err == fs.SkipDir {
+					skipPrefixes = append(skipPrefixes, d+"/")
+					skipped = true
+					break
+				}
+				return err
+			}
+		}
+
+		if skipped {
+			continue
+		}
+
+		err := fn(k, files[k], nil)
+		if err != nil {
+			if err == fs.SkipDir {
+				if pd := parentDir(k); len(pd) > len(root) {
+					skipPrefixes = append(skipPrefixes, pd+"/")
+					continue
+				}
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parentDir(p string) string {
+	if i := strings.LastIndex(p, "/"); i > -1 {
+		return p[:i]
+	}
+	return ""
+}
+
+func baseName(p string) string {
+	return p[strings.LastIndex(p, "/")+1:]
+}
+
+// NopCloser returns a ReadSeekCloser with a no-op Close method wrapping the provided ReadSeeker.
+func NopCloser(rs io.ReadSeeker) io.ReadSeekCloser {
+	return nopCloser{rs}
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"time"
+)
+
+type FileInfoSt struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// WalkFunc is called for every item under the walked path (excluding the path itself).
+// Returning fs.SkipDir for a directory skips its content.
+type WalkFunc func(p string, info *FileInfoSt, err error) error
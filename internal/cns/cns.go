@@ -1,8 +1,17 @@
 package cns
 
+import (
+	"time"
+)
+
 const (
 	ZipDirNamePrefix            = "__fs-zip-dir_"
 	KvsDirNamePrefix            = "__fs-kvs-dir_"
+	MetaDirNamePrefix           = "__fs-meta-dir_"
 	DefaultCleanChunkSize       = 100
 	CleanFileNotCheckPeriodDays = 3
+	ZipRatioCheckMinSize        = 1024 * 1024
+	DefaultUrlSignTtl           = time.Hour
+	StaticListDefaultPageSize   = 100
+	StaticListMaxPageSize       = 1000
 )
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rendau/dop/dopErrs"
+	"github.com/rendau/fs/internal/domain/types"
+)
+
+type Auth struct {
+	r         *St
+	apiKeys   map[string]*types.AuthScopeSt
+	jwtSecret []byte
+}
+
+type authJwtClaimsSt struct {
+	jwt.RegisteredClaims
+	types.AuthScopeSt
+}
+
+func NewAuth(r *St, apiKeys map[string]*types.AuthScopeSt, jwtSecret string) *Auth {
+	keys := make(map[string]*types.AuthScopeSt, len(apiKeys))
+
+	for key, scope := range apiKeys {
+		scopeCopy := *scope
+
+		// key itself must not be exposed
+		keyHash := sha256.Sum256([]byte(key))
+		scopeCopy.Id = "key:" + hex.EncodeToString(keyHash[:])[:12]
+
+		keys[key] = &scopeCopy
+	}
+
+	return &Auth{
+		r:         r,
+		apiKeys:   keys,
+		jwtSecret: []byte(jwtSecret),
+	}
+}
+
+// IsEnabled returns false when neither api-keys nor jwt-secret are configured,
+// in that case all operations are allowed without token
+func (c *Auth) IsEnabled() bool {
+	return len(c.apiKeys) > 0 || len(c.jwtSecret) > 0
+}
+
+// GetScope resolves token (static api-key or HS256-signed jwt) into access scope
+func (c *Auth) GetScope(token string) (*types.AuthScopeSt, error) {
+	if !c.IsEnabled() {
+		return types.NewFullAuthScope(), nil
+	}
+
+	if token == "" {
+		return nil, dopErrs.NotAuthorized
+	}
+
+	for key, scope := range c.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			return scope, nil
+		}
+	}
+
+	if len(c.jwtSecret) == 0 {
+		return nil, dopErrs.NotAuthorized
+	}
+
+	claims := &authJwtClaimsSt{}
+
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		return c.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, dopErrs.NotAuthorized
+	}
+
+	// tokens without expiration are not accepted
+	if claims.ExpiresAt == nil {
+		return nil, dopErrs.NotAuthorized
+	}
+
+	claims.AuthScopeSt.Id = "jwt:" + claims.Subject
+
+	return &claims.AuthScopeSt, nil
+}
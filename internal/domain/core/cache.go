@@ -1,42 +1,59 @@
 package core
 
 import (
+	"container/list"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/rendau/fs/internal/domain/types"
+	"github.com/rendau/fs/internal/domain/util"
 )
 
+// Cache is a LRU-cache, bounded by count of entries and/or total size of data
 type Cache struct {
 	r *St
 
-	maxCount int
-	ttl      time.Duration
+	maxCount     int
+	maxSize      int64
+	maxEntrySize int64
+	ttl          time.Duration
 
-	m   map[string]*cacheVSt
-	mMu sync.RWMutex
+	m    map[string]*list.Element
+	l    *list.List // of *cacheVSt, front - recently used
+	size int64
+	mMu  sync.Mutex
+
+	hits      int64
+	misses    int64
+	evictions int64
 }
 
 type cacheVSt struct {
-	st time.Time
+	key string
+	st  time.Time
 
-	name string
-	data []byte
-	mt   time.Time
+	name  string
+	data  []byte
+	mt    time.Time
+	srcMt time.Time // modification time of source file
 }
 
-func NewCache(r *St, maxCount int, ttl time.Duration) *Cache {
+func NewCache(r *St, maxCount int, maxSize int64, maxEntrySize int64, ttl time.Duration) *Cache {
 	return &Cache{
-		r:        r,
-		maxCount: maxCount,
-		ttl:      ttl,
-		m:        map[string]*cacheVSt{},
+		r:            r,
+		maxCount:     maxCount,
+		maxSize:      maxSize,
+		maxEntrySize: maxEntrySize,
+		ttl:          ttl,
+		m:            map[string]*list.Element{},
+		l:            list.New(),
 	}
 }
 
 func (c *Cache) Start() {
-	if c.maxCount > 0 {
+	if c.isEnabled() {
 		go func() {
 			for {
 				time.Sleep(time.Minute)
@@ -47,8 +64,14 @@ func (c *Cache) Start() {
 	}
 }
 
-func (c *Cache) Set(key string, name string, mt time.Time, data []byte) {
-	if c.maxCount == 0 {
+func (c *Cache) Set(key string, name string, mt time.Time, srcMt time.Time, data []byte) {
+	if !c.isEnabled() {
+		return
+	}
+
+	dataSize := int64(len(data))
+
+	if (c.maxEntrySize > 0 && dataSize > c.maxEntrySize) || (c.maxSize > 0 && dataSize > c.maxSize) {
 		return
 	}
 
@@ -57,75 +80,180 @@ func (c *Cache) Set(key string, name string, mt time.Time, data []byte) {
 
 	now := time.Now()
 
-	if cv, found := c.m[key]; found {
+	if el, found := c.m[key]; found {
+		cv := el.Value.(*cacheVSt)
+		c.size += dataSize - int64(len(cv.data))
 		cv.st = now
 		cv.name = name
 		cv.mt = mt
+		cv.srcMt = srcMt
 		cv.data = data
-		return
-	}
-
-	c.m[key] = &cacheVSt{
-		st:   now,
-		name: name,
-		mt:   mt,
-		data: data,
+		c.l.MoveToFront(el)
+	} else {
+		c.m[key] = c.l.PushFront(&cacheVSt{
+			key:   key,
+			st:    now,
+			name:  name,
+			mt:    mt,
+			srcMt: srcMt,
+			data:  data,
+		})
+		c.size += dataSize
 	}
 
-	if len(c.m) > c.maxCount {
-		c.removeOldestOne()
+	for (c.maxCount > 0 && c.l.Len() > c.maxCount) || (c.maxSize > 0 && c.size > c.maxSize) {
+		c.removeElement(c.l.Back())
+		c.evictions++
 	}
 }
 
-func (c *Cache) GetAndRefresh(key string) (string, time.Time, []byte) {
+// GetAndRefresh returns cached entry, if it is created from source file with modification time srcMt
+func (c *Cache) GetAndRefresh(key string, srcMt time.Time) (string, time.Time, []byte) {
 	c.mMu.Lock()
 	defer c.mMu.Unlock()
 
 	now := time.Now()
 
-	if cv, found := c.m[key]; found {
+	if el, found := c.m[key]; found {
+		cv := el.Value.(*cacheVSt)
+
+		if !cv.srcMt.Equal(srcMt) { // source file is changed
+			c.removeElement(el)
+			c.misses++
+			return "", now, nil
+		}
+
 		cv.st = now
+		c.l.MoveToFront(el)
+		c.hits++
 		return cv.name, cv.mt, cv.data
 	}
 
+	c.misses++
+
 	return "", now, nil
 }
 
-func (c *Cache) GenerateKey(reqPath string, imgPars *types.ImgParsSt, download bool) string {
-	return reqPath + "?" + imgPars.String() + "&dl=" + strconv.FormatBool(download)
+func (c *Cache) GetStats() *types.CacheStatsSt {
+	c.mMu.Lock()
+	defer c.mMu.Unlock()
+
+	return &types.CacheStatsSt{
+		Count:     c.l.Len(),
+		Size:      c.size,
+		MaxCount:  c.maxCount,
+		MaxSize:   c.maxSize,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
 }
 
-func (c *Cache) removeOldestOne() {
-	var xK string
-	var xV *cacheVSt
+func (c *Cache) Remove(key string) bool {
+	c.mMu.Lock()
+	defer c.mMu.Unlock()
+
+	if el, found := c.m[key]; found {
+		c.removeElement(el)
+		return true
+	}
+
+	return false
+}
+
+// RemoveByPrefix removes entries of file or all files in dir with path p, returns count of removed entries
+func (c *Cache) RemoveByPrefix(p string) int {
+	p = util.ToStoragePath(p)
+
+	c.mMu.Lock()
+	defer c.mMu.Unlock()
 
-	for k, v := range c.m {
-		if xV == nil || v.st.Before(xV.st) {
-			xK = k
-			xV = v
+	result := 0
+
+	for key, el := range c.m {
+		if p == "" || strings.HasPrefix(key, p+"?") || strings.HasPrefix(key, p+"/") {
+			c.removeElement(el)
+			result++
 		}
 	}
 
-	if xK != "" {
-		delete(c.m, xK)
+	return result
+}
+
+// WarmUp creates derivatives of files for all img-params, returns count of created and errors by "path?name".
+// If format is not set and auto format applies to file, webp derivative is created too (errors by "path?name&format=webp").
+func (c *Cache) WarmUp(reqPaths []string, imgParsList map[string]*types.ImgParsSt) (int, map[string]error) {
+	done := 0
+	errors := map[string]error{}
+
+	for _, reqPath := range reqPaths {
+		for name, imgPars := range imgParsList {
+			formats := []string{imgPars.Format}
+
+			if imgPars.Format == "" {
+				if format, _ := c.r.Img.NegotiateFormat(reqPath, "image/webp"); format != "" {
+					formats = append(formats, format)
+				}
+			}
+
+			for _, format := range formats {
+				errKey := reqPath + "?" + name
+				if format != imgPars.Format {
+					errKey += "&format=" + format
+				}
+
+				imgParsCopy := *imgPars
+				imgParsCopy.Format = format
+
+				file, err := c.r.Static.Get(reqPath, &imgParsCopy, false)
+				if err != nil {
+					errors[errKey] = err
+					continue
+				}
+				file.Close()
+
+				done++
+			}
+		}
 	}
+
+	return done, errors
+}
+
+func (c *Cache) GenerateKey(reqPath string, imgPars *types.ImgParsSt, download bool) string {
+	return util.ToStoragePath(reqPath) + "?" + imgPars.String() + "&dl=" + strconv.FormatBool(download)
+}
+
+func (c *Cache) GenerateMetaKey(reqPath string) string {
+	return util.ToStoragePath(reqPath) + "?meta"
+}
+
+func (c *Cache) GenerateUploadMetaKey(reqPath string) string {
+	return util.ToStoragePath(reqPath) + "?upload-meta"
+}
+
+func (c *Cache) isEnabled() bool {
+	return c.maxCount > 0 || c.maxSize > 0
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	cv := c.l.Remove(el).(*cacheVSt)
+	delete(c.m, cv.key)
+	c.size -= int64(len(cv.data))
 }
 
 func (c *Cache) removeExpired() {
 	c.mMu.Lock()
 	defer c.mMu.Unlock()
 
-	var expiredKeys []string
-
 	now := time.Now()
 
-	for k, v := range c.m {
-		if v.st.Add(c.ttl).Before(now) {
-			expiredKeys = append(expiredKeys, k)
+	// list is ordered by access time, so expired entries are at the back
+	for el := c.l.Back(); el != nil; el = c.l.Back() {
+		if !el.Value.(*cacheVSt).st.Add(c.ttl).Before(now) {
+			break
 		}
-	}
 
-	for _, k := range expiredKeys {
-		delete(c.m, k)
+		c.removeElement(el)
 	}
 }
@@ -1,12 +1,14 @@
 package core
 
 import (
-	"os"
-	"path/filepath"
+	"errors"
+	"io/fs"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/rendau/fs/internal/adapters/cleaner"
+	"github.com/rendau/fs/internal/adapters/storage"
 	"github.com/rendau/fs/internal/cns"
 )
 
@@ -41,8 +43,6 @@ func (c *Clean) routine(checkChunkSize int) {
 
 	stop := false
 
-	rootDirPath := c.r.dirPath
-
 	var pathList []string
 
 	var totalCount uint64
@@ -50,9 +50,9 @@ func (c *Clean) routine(checkChunkSize int) {
 
 	startTime := time.Now()
 
-	err := filepath.Walk(rootDirPath, func(p string, info os.FileInfo, err error) error {
+	err := c.r.storage.Walk("", func(p string, info *storage.FileInfoSt, err error) error {
 		if stop {
-			return filepath.SkipDir
+			return fs.SkipDir
 		}
 
 		if err != nil {
@@ -64,11 +64,7 @@ func (c *Clean) routine(checkChunkSize int) {
 			return nil
 		}
 
-		if p == rootDirPath {
-			return nil
-		}
-
-		mtIsAllowed := info.ModTime().AddDate(0, 0, cns.CleanFileNotCheckPeriodDays).Before(time.Now())
+		mtIsAllowed := info.ModTime.AddDate(0, 0, cns.CleanFileNotCheckPeriodDays).Before(time.Now())
 
 		if len(pathList) >= checkChunkSize {
 			removedCount += c.pathListRoutine(pathList)
@@ -76,37 +72,36 @@ func (c *Clean) routine(checkChunkSize int) {
 			pathList = nil
 
 			if stop = c.r.IsStopped(); stop {
-				return filepath.SkipDir
+				return fs.SkipDir
 			}
 		}
 
-		relPath, err := filepath.Rel(rootDirPath, p)
-		if err != nil {
-			c.r.lg.Errorw("Fail to get rel p", err, "path", p, "root_dir_path", rootDirPath)
-			return err
-		}
+		if info.IsDir {
+			// upload-metas are removed with their files
+			if p == cns.MetaDirNamePrefix {
+				return fs.SkipDir
+			}
 
-		if info.IsDir() {
-			if !strings.HasPrefix(info.Name(), cns.ZipDirNamePrefix) {
+			if !strings.HasPrefix(info.Name, cns.ZipDirNamePrefix) {
 				return nil
 			}
 
 			if !mtIsAllowed {
-				return filepath.SkipDir
+				return fs.SkipDir
 			}
 
-			pathList = append(pathList, relPath+"/")
+			pathList = append(pathList, p+"/")
 
 			totalCount++
 
-			return filepath.SkipDir
+			return fs.SkipDir
 		}
 
 		if !mtIsAllowed {
 			return nil
 		}
 
-		pathList = append(pathList, relPath)
+		pathList = append(pathList, p)
 
 		totalCount++
 
@@ -119,7 +114,7 @@ func (c *Clean) routine(checkChunkSize int) {
 
 	removedCount += c.pathListRoutine(pathList)
 
-	err = c.removeEmptyDirs(rootDirPath)
+	err = c.removeEmptyDirs()
 	if err != nil {
 		c.r.lg.Errorw("Fail to remove empty dirs", err)
 		return
@@ -150,23 +145,28 @@ func (c *Clean) pathListRoutine(pathList []string) uint64 {
 	for _, p := range rmPathList {
 		// c.r.lg.Infow("Want to remove", "f_path", p)
 
-		err = os.RemoveAll(filepath.Join(c.r.dirPath, p))
+		err = c.r.storage.Remove(p)
 		if err != nil {
 			c.r.lg.Errorw("Fail to remove path", err, "path", p)
 		}
+
+		c.r.Cache.RemoveByPrefix(p)
+		c.r.DiskCache.RemoveByPrefix(p)
+
+		c.r.Static.RemoveUploadMeta(p)
 	}
 
 	return uint64(len(rmPathList))
 }
 
-func (c *Clean) removeEmptyDirs(rootDirPath string) error {
+func (c *Clean) removeEmptyDirs() error {
 	if c.r.IsStopped() {
 		return nil
 	}
 
 	dirs := map[string]uint64{}
 
-	err := filepath.Walk(rootDirPath, func(p string, info os.FileInfo, err error) error {
+	err := c.r.storage.Walk("", func(p string, info *storage.FileInfoSt, err error) error {
 		if err != nil {
 			return err
 		}
@@ -175,15 +175,11 @@ func (c *Clean) removeEmptyDirs(rootDirPath string) error {
 			return nil
 		}
 
-		if p == rootDirPath {
-			return nil
-		}
-
-		if parentPath := filepath.Dir(p); parentPath != rootDirPath {
+		if parentPath := path.Dir(p); parentPath != "." {
 			dirs[parentPath]++
 		}
 
-		if info.IsDir() {
+		if info.IsDir {
 			if _, ok := dirs[p]; !ok {
 				dirs[p] = 0
 			}
@@ -199,18 +195,16 @@ func (c *Clean) removeEmptyDirs(rootDirPath string) error {
 
 	rr = func() error {
 		for k, v := range dirs {
-			if k == rootDirPath {
-				continue
-			}
-
 			if v <= 0 {
-				parentPath := filepath.Dir(k)
-				if _, ok := dirs[parentPath]; ok {
-					dirs[parentPath]--
-				}
-
-				err = os.RemoveAll(k)
-				if err != nil {
+				// non-recursive, dir may get files after walk
+				err = c.r.storage.RemoveDir(k)
+				switch {
+				case err == nil || errors.Is(err, fs.ErrNotExist):
+					if _, ok := dirs[path.Dir(k)]; ok {
+						dirs[path.Dir(k)]--
+					}
+				case errors.Is(err, fs.ErrExist): // not empty anymore, so parent is kept too
+				default:
 					return err
 				}
 
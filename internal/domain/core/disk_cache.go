@@ -0,0 +1,348 @@
+package core
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rendau/fs/internal/adapters/storage"
+	"github.com/rendau/fs/internal/domain/types"
+	"github.com/rendau/fs/internal/domain/util"
+)
+
+// suffix of file being written, it is renamed to key when complete
+const diskCacheTmpSuffix = ".tmp"
+
+// DiskCache is a persistent LRU-cache of derivatives, second tier behind Cache.
+// Index is kept in memory and restored from storage on Start.
+// Entries are stored under the path of source file, so they can be purged by path prefix.
+type DiskCache struct {
+	r *St
+
+	storage storage.Storage
+	maxSize int64
+	ttl     time.Duration
+
+	m    map[string]*list.Element
+	l    *list.List // of *diskCacheVSt, front - recently used
+	size int64
+	mMu  sync.Mutex
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type diskCacheVSt struct {
+	key  string // file path in storage
+	st   time.Time
+	size int64
+}
+
+func NewDiskCache(r *St, storage storage.Storage, maxSize int64, ttl time.Duration) *DiskCache {
+	return &DiskCache{
+		r:       r,
+		storage: storage,
+		maxSize: maxSize,
+		ttl:     ttl,
+		m:       map[string]*list.Element{},
+		l:       list.New(),
+	}
+}
+
+func (c *DiskCache) Start() {
+	if c.storage == nil {
+		return
+	}
+
+	c.loadIndex()
+
+	if c.ttl > 0 {
+		go func() {
+			for {
+				time.Sleep(time.Minute)
+
+				c.removeExpired()
+			}
+		}()
+	}
+}
+
+// GenerateKey returns key for cache-key of Cache and modification time of source file:
+// "<source path>/<hash of cache-key>_<mod-time>"
+func (c *DiskCache) GenerateKey(cKey string, srcModTime time.Time) string {
+	return c.getKeyPrefix(cKey) + strconv.FormatInt(srcModTime.UnixNano(), 36)
+}
+
+func (c *DiskCache) Get(key string) []byte {
+	if c.storage == nil {
+		return nil
+	}
+
+	c.mMu.Lock()
+	el, found := c.m[key]
+	if found {
+		el.Value.(*diskCacheVSt).st = time.Now()
+		c.l.MoveToFront(el)
+	}
+	c.mMu.Unlock()
+
+	if !found {
+		atomic.AddInt64(&c.misses, 1)
+		return nil
+	}
+
+	f, err := c.storage.Get(key)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.r.lg.Errorw("Fail to open disk-cache file", err, "key", key)
+		}
+		c.remove(key)
+		atomic.AddInt64(&c.misses, 1)
+		return nil
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.r.lg.Errorw("Fail to read disk-cache file", err, "key", key)
+		atomic.AddInt64(&c.misses, 1)
+		return nil
+	}
+
+	atomic.AddInt64(&c.hits, 1)
+
+	return data
+}
+
+func (c *DiskCache) GetStats() *types.CacheStatsSt {
+	c.mMu.Lock()
+	defer c.mMu.Unlock()
+
+	return &types.CacheStatsSt{
+		Count:     c.l.Len(),
+		Size:      c.size,
+		MaxSize:   c.maxSize,
+		Hits:      atomic.LoadInt64(&c.hits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Evictions: c.evictions,
+	}
+}
+
+// Remove removes entries of cache-key of Cache (for any mod-time of source file), returns count of removed entries
+func (c *DiskCache) Remove(cKey string) int {
+	return c.removeByKeyPrefix(c.getKeyPrefix(cKey))
+}
+
+// RemoveByPrefix removes entries of file or all files in dir with path p, returns count of removed entries
+func (c *DiskCache) RemoveByPrefix(p string) int {
+	p = util.ToStoragePath(p)
+	if p != "" {
+		p += "/"
+	}
+
+	return c.removeByKeyPrefix(p)
+}
+
+func (c *DiskCache) Set(key string, data []byte) {
+	if c.storage == nil {
+		return
+	}
+
+	dataSize := int64(len(data))
+
+	if c.maxSize > 0 && dataSize > c.maxSize {
+		return
+	}
+
+	// truncated file (crash, no space) must never appear under key
+	tmpPath := key + diskCacheTmpSuffix
+
+	err := c.storage.Put(tmpPath, bytes.NewReader(data))
+	if err == nil {
+		err = c.storage.Rename(tmpPath, key)
+	}
+	if err != nil {
+		c.r.lg.Errorw("Fail to put disk-cache file", err, "key", key)
+		c.removeFiles([]string{tmpPath})
+		return
+	}
+
+	c.mMu.Lock()
+	c.add(key, time.Now(), dataSize)
+	victims := c.evict()
+	c.mMu.Unlock()
+
+	c.removeFiles(victims)
+}
+
+func (c *DiskCache) getKeyPrefix(cKey string) string {
+	srcPath := cKey
+	if i := strings.LastIndex(cKey, "?"); i >= 0 {
+		srcPath = cKey[:i]
+	}
+
+	hash := sha256.Sum256([]byte(cKey))
+
+	return path.Join(srcPath, hex.EncodeToString(hash[:])) + "_"
+}
+
+func (c *DiskCache) loadIndex() {
+	type itemSt struct {
+		key  string
+		st   time.Time
+		size int64
+	}
+
+	items := make([]itemSt, 0)
+
+	var tmpPaths []string
+
+	err := c.storage.Walk("", func(p string, info *storage.FileInfoSt, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir:
+		case strings.HasSuffix(p, diskCacheTmpSuffix): // left by interrupted Set
+			tmpPaths = append(tmpPaths, p)
+		default:
+			items = append(items, itemSt{key: p, st: info.ModTime, size: info.Size})
+		}
+
+		return nil
+	})
+	if err != nil {
+		c.r.lg.Errorw("Fail to walk disk-cache", err)
+	}
+
+	c.removeFiles(tmpPaths)
+
+	// oldest first, so recent ones are at the front of list
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].st.Before(items[j].st)
+	})
+
+	c.mMu.Lock()
+	for _, item := range items {
+		c.add(item.key, item.st, item.size)
+	}
+	victims := c.evict()
+	c.mMu.Unlock()
+
+	c.removeFiles(victims)
+}
+
+// add must be called under lock
+func (c *DiskCache) add(key string, st time.Time, size int64) {
+	if el, found := c.m[key]; found {
+		cv := el.Value.(*diskCacheVSt)
+		c.size += size - cv.size
+		cv.st = st
+		cv.size = size
+		c.l.MoveToFront(el)
+		return
+	}
+
+	c.m[key] = c.l.PushFront(&diskCacheVSt{key: key, st: st, size: size})
+	c.size += size
+}
+
+// evict must be called under lock, returns keys of removed entries
+func (c *DiskCache) evict() []string {
+	var result []string
+
+	for c.maxSize > 0 && c.size > c.maxSize {
+		result = append(result, c.removeElement(c.l.Back()))
+		c.evictions++
+	}
+
+	return result
+}
+
+func (c *DiskCache) remove(key string) {
+	c.mMu.Lock()
+	defer c.mMu.Unlock()
+
+	if el, found := c.m[key]; found {
+		c.removeElement(el)
+	}
+}
+
+func (c *DiskCache) removeElement(el *list.Element) string {
+	cv := c.l.Remove(el).(*diskCacheVSt)
+	delete(c.m, cv.key)
+	c.size -= cv.size
+	return cv.key
+}
+
+func (c *DiskCache) removeByKeyPrefix(prefix string) int {
+	if c.storage == nil {
+		return 0
+	}
+
+	var victims []string
+
+	c.mMu.Lock()
+	for key, el := range c.m {
+		if strings.HasPrefix(key, prefix) {
+			victims = append(victims, c.removeElement(el))
+		}
+	}
+	c.mMu.Unlock()
+
+	c.removeFiles(victims)
+
+	return len(victims)
+}
+
+func (c *DiskCache) removeExpired() {
+	var victims []string
+
+	now := time.Now()
+
+	c.mMu.Lock()
+	for el := c.l.Back(); el != nil; el = c.l.Back() {
+		if !el.Value.(*diskCacheVSt).st.Add(c.ttl).Before(now) {
+			break
+		}
+
+		victims = append(victims, c.removeElement(el))
+	}
+	c.mMu.Unlock()
+
+	c.removeFiles(victims)
+}
+
+func (c *DiskCache) removeFiles(keys []string) {
+	for _, key := range keys {
+		err := c.storage.Remove(key)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			c.r.lg.Errorw("Fail to remove disk-cache file", err, "key", key)
+			continue
+		}
+
+		// dirs of source path, until the first non-empty
+		for dirPath := path.Dir(key); dirPath != "." && dirPath != "/"; dirPath = path.Dir(dirPath) {
+			err = c.storage.RemoveDir(dirPath)
+			if err != nil {
+				if !errors.Is(err, fs.ErrExist) && !errors.Is(err, fs.ErrNotExist) {
+					c.r.lg.Errorw("Fail to remove disk-cache dir", err, "path", dirPath)
+				}
+				break
+			}
+		}
+	}
+}
@@ -1,15 +1,29 @@
 package core
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"image"
+	"image/color"
+	"image/png"
 	"io"
-	"path/filepath"
+	"path"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/disintegration/imaging"
+	"github.com/gen2brain/webp"
+	"github.com/rendau/fs/internal/domain/errs"
 	"github.com/rendau/fs/internal/domain/types"
 )
 
+// imgFormatWebP - webp format, imaging has no webp encoder.
+// Decoding and encoding (lossy) are done by libwebp: shared library if it is installed, otherwise its wasm build.
+const imgFormatWebP imaging.Format = -1
+
 var (
 	imgFileTypes = map[string]struct {
 		format      imaging.Format
@@ -21,26 +35,84 @@ var (
 		".tif":  {imaging.TIFF, "image/tiff"},
 		".tiff": {imaging.TIFF, "image/tiff"},
 		".bmp":  {imaging.BMP, "image/bmp"},
+		".webp": {imgFormatWebP, "image/webp"},
 		// ".gif":  {imaging.GIF, "image/gif"},
 	}
+
+	// output formats (`fmt` param) -> file extension
+	imgOutputFormats = map[string]string{
+		"jpeg": ".jpg",
+		"png":  ".png",
+		"webp": ".webp",
+	}
+
+	// gravity (`g` param) -> anchor for "fill" method
+	imgGravities = map[string]imaging.Anchor{
+		"":           imaging.Center,
+		"center":     imaging.Center,
+		"north":      imaging.Top,
+		"south":      imaging.Bottom,
+		"east":       imaging.Right,
+		"west":       imaging.Left,
+		"north-east": imaging.TopRight,
+		"north-west": imaging.TopLeft,
+		"south-east": imaging.BottomRight,
+		"south-west": imaging.BottomLeft,
+	}
+
+	// source file extensions, which can be converted by Accept header
+	imgAutoFormatFileExts = map[string]bool{
+		".jpg":  true,
+		".jpeg": true,
+		".png":  true,
+	}
 )
 
 type Img struct {
-	r            *St
-	wMarkPath    string
-	wMark        image.Image
-	wMarkOpacity float64
+	r              *St
+	autoFormat     bool
+	qualityDefault int
+	qualityMax     int
+	limits         types.ImgLimitsSt
+	queue          chan struct{}
+	queueTimeout   time.Duration
+	queueWaiting   int64
+	queueTimeouts  int64
+	wMarkPath      string
+	wMark          image.Image
+	wMarkOpacity   float64
 }
 
-func NewImg(r *St, wMarkPath string, wMarkOpacity float64) *Img {
+func NewImg(
+	r *St,
+	autoFormat bool,
+	qualityDefault int,
+	qualityMax int,
+	limits types.ImgLimitsSt,
+	concurrency int,
+	queueTimeout time.Duration,
+	wMarkPath string,
+	wMarkOpacity float64,
+) *Img {
 	if wMarkOpacity == 0 {
 		wMarkOpacity = 1
 	}
 
+	var queue chan struct{}
+	if concurrency > 0 {
+		queue = make(chan struct{}, concurrency)
+	}
+
 	return &Img{
-		r:            r,
-		wMarkPath:    wMarkPath,
-		wMarkOpacity: wMarkOpacity,
+		r:              r,
+		autoFormat:     autoFormat,
+		qualityDefault: qualityDefault,
+		qualityMax:     qualityMax,
+		limits:         limits,
+		queue:          queue,
+		queueTimeout:   queueTimeout,
+		wMarkPath:      wMarkPath,
+		wMarkOpacity:   wMarkOpacity,
 	}
 }
 
@@ -56,12 +128,194 @@ func (c *Img) Start() {
 	}
 }
 
+// PreparePars validates params from request and applies server-side limits
+func (c *Img) PreparePars(pars *types.ImgParsSt) error {
+	if _, ok := imgOutputFormats[pars.Format]; !ok && pars.Format != "" {
+		return errs.BadImageFormat
+	}
+
+	if _, ok := imgGravities[pars.Gravity]; !ok {
+		return errs.BadImageGravity
+	}
+
+	if _, err := parseHexColor(pars.BgColor); err != nil {
+		return errs.BadImageBgColor
+	}
+
+	if !pars.Crop.IsEmpty() && (pars.Crop.X < 0 || pars.Crop.Y < 0 || pars.Crop.Width <= 0 || pars.Crop.Height <= 0) {
+		return errs.BadImageCrop
+	}
+
+	if pars.Rotate != 0 && pars.Rotate != 90 && pars.Rotate != 180 && pars.Rotate != 270 {
+		return errs.BadImageRotate
+	}
+
+	if pars.Flip != "" && pars.Flip != "h" && pars.Flip != "v" && pars.Flip != "hv" {
+		return errs.BadImageFlip
+	}
+
+	if pars.Blur < 0 || pars.Sharpen < 0 || pars.Gamma < 0 ||
+		pars.Brightness < -100 || pars.Brightness > 100 ||
+		pars.Contrast < -100 || pars.Contrast > 100 ||
+		pars.Saturation < -100 || pars.Saturation > 500 {
+		return errs.BadImageAdjustment
+	}
+
+	if pars.Quality < 0 || pars.Quality > 100 {
+		return errs.BadImageQuality
+	}
+
+	if c.qualityMax > 0 && pars.Quality > c.qualityMax {
+		pars.Quality = c.qualityMax
+	}
+
+	return c.checkLimits(pars)
+}
+
+func (c *Img) checkLimits(pars *types.ImgParsSt) error {
+	if pars.Width < 0 || pars.Height < 0 {
+		return errs.BadImageSize
+	}
+
+	if (c.limits.MaxWidth > 0 && pars.Width > c.limits.MaxWidth) ||
+		(c.limits.MaxHeight > 0 && pars.Height > c.limits.MaxHeight) {
+		return errs.ImageSizeNotAllowed
+	}
+
+	if len(c.limits.Sizes) > 0 && (pars.Width > 0 || pars.Height > 0) {
+		allowed := false
+
+		for _, size := range c.limits.Sizes {
+			if size.Width == pars.Width && size.Height == pars.Height {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return errs.ImageSizeNotAllowed
+		}
+	}
+
+	if c.limits.MaxBlur > 0 && (pars.Blur > c.limits.MaxBlur || pars.Sharpen > c.limits.MaxBlur) {
+		return errs.ImageBlurNotAllowed
+	}
+
+	return nil
+}
+
+// checkCanvasSize checks final size of the result image against limits
+func (c *Img) checkCanvasSize(w, h int) error {
+	if (c.limits.MaxWidth > 0 && w > c.limits.MaxWidth) ||
+		(c.limits.MaxHeight > 0 && h > c.limits.MaxHeight) {
+		return errs.ImageSizeNotAllowed
+	}
+
+	if c.limits.MaxSourcePixels > 0 && int64(w)*int64(h) > c.limits.MaxSourcePixels {
+		return errs.ImageSizeNotAllowed
+	}
+
+	return nil
+}
+
+// NegotiateFormat chooses output format for fPath by Accept header value.
+// vary is true if response depends on Accept header.
+func (c *Img) NegotiateFormat(fPath string, accept string) (format string, vary bool) {
+	if !c.autoFormat || !imgAutoFormatFileExts[strings.ToLower(path.Ext(fPath))] {
+		return "", false
+	}
+
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(item, ";")
+
+		if strings.TrimSpace(mediaType) != "image/webp" {
+			continue
+		}
+
+		// skip "image/webp;q=0"
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+
+		return "webp", true
+	}
+
+	return "", true
+}
+
+// GetOutputName returns name of the result file of Handle (extension changes on format conversion)
+func (c *Img) GetOutputName(fName string, pars *types.ImgParsSt) string {
+	fileExt := path.Ext(fName)
+
+	if _, ok := imgFileTypes[strings.ToLower(fileExt)]; !ok {
+		return fName
+	}
+
+	if outExt, ok := imgOutputFormats[pars.Format]; ok {
+		return strings.TrimSuffix(fName, fileExt) + outExt
+	}
+
+	return fName
+}
+
+// GetContentType returns content type of image file by extension, ok is false for non-image files
+func (c *Img) GetContentType(fPath string) (string, bool) {
+	imgFormat, ok := imgFileTypes[strings.ToLower(path.Ext(fPath))]
+
+	return imgFormat.contentType, ok
+}
+
+// GetSize returns dimensions of image file with applied exif-orientation.
+// Only header and exif are read (image is not decoded). Returns zeros for non-image files.
+func (c *Img) GetSize(fPath string) (int, int, error) {
+	if _, ok := c.GetContentType(fPath); !ok {
+		return 0, 0, nil
+	}
+
+	f, err := c.r.storage.Get(fPath)
+	if err != nil {
+		c.r.lg.Errorw("Fail to open file", err, "f_path", fPath)
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	imgConfig, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, nil // not an image
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		c.r.lg.Errorw("Fail to seek file", err, "f_path", fPath)
+		return 0, 0, err
+	}
+
+	// orientations 5-8 are rotated by 90 degrees
+	if readExifOrientation(f) >= 5 {
+		return imgConfig.Height, imgConfig.Width, nil
+	}
+
+	return imgConfig.Width, imgConfig.Height, nil
+}
+
+// Handle transforms image for derivative requests, sources are limited by MaxSourcePixels
 func (c *Img) Handle(fPath string, w io.Writer, pars *types.ImgParsSt) error {
+	return c.handle(fPath, w, pars, c.limits.MaxSourcePixels)
+}
+
+// HandleUpload transforms uploaded image, sources are limited by MaxUploadPixels
+func (c *Img) HandleUpload(fPath string, w io.Writer, pars *types.ImgParsSt) error {
+	return c.handle(fPath, w, pars, c.limits.MaxUploadPixels)
+}
+
+func (c *Img) handle(fPath string, w io.Writer, pars *types.ImgParsSt, maxSourcePixels int64) error {
 	if pars.IsEmpty() {
 		return nil
 	}
 
-	fileExt := strings.ToLower(filepath.Ext(fPath))
+	fileExt := strings.ToLower(path.Ext(fPath))
 
 	imgFormat, ok := imgFileTypes[fileExt]
 	if !ok {
@@ -69,20 +323,94 @@ func (c *Img) Handle(fPath string, w io.Writer, pars *types.ImgParsSt) error {
 	}
 
 	pM := pars.Method
+	pCrop := pars.Crop
 	pW := pars.Width
 	pH := pars.Height
+	pRotate := pars.Rotate
+	pFlip := pars.Flip
 	pBlur := pars.Blur
+	pSharpen := pars.Sharpen
 	pGrayscale := pars.Grayscale
 	pWMark := pars.WMark
 
-	hasChanges := false
+	hasChanges := pars.Quality > 0
 
-	img, err := imaging.Open(fPath, imaging.AutoOrientation(true))
+	if outExt, ok := imgOutputFormats[pars.Format]; ok {
+		if outFormat := imgFileTypes[outExt]; outFormat.format != imgFormat.format {
+			imgFormat = outFormat
+			hasChanges = true
+		}
+	}
+
+	f, err := c.r.storage.Get(fPath)
+	if err != nil {
+		c.r.lg.Errorw("Fail to open file", err, "f_path", fPath)
+		return err
+	}
+	defer f.Close()
+
+	err = c.acquireSlot()
 	if err != nil {
-		// c.lg.Errorw("Fail to open img", err)
+		return err
+	}
+	defer c.releaseSlot()
+
+	if maxSourcePixels > 0 {
+		imgConfig, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return nil // not an image
+		}
+
+		if int64(imgConfig.Width)*int64(imgConfig.Height) > maxSourcePixels {
+			return errs.ImageSourceTooLarge
+		}
+
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			c.r.lg.Errorw("Fail to seek file", err, "f_path", fPath)
+			return err
+		}
+	}
+
+	img, err := imaging.Decode(f, imaging.AutoOrientation(true))
+	if err != nil {
+		// c.lg.Errorw("Fail to decode img", err)
 		return nil
 	}
 
+	if !pCrop.IsEmpty() {
+		cropRect := image.Rect(pCrop.X, pCrop.Y, pCrop.X+pCrop.Width, pCrop.Y+pCrop.Height).Add(img.Bounds().Min)
+		if !cropRect.Overlaps(img.Bounds()) {
+			return errs.BadImageCrop
+		}
+
+		img = imaging.Crop(img, cropRect)
+
+		hasChanges = true
+	}
+
+	switch pRotate {
+	case 90:
+		img = imaging.Rotate270(img) // imaging rotates counter-clockwise
+		hasChanges = true
+	case 180:
+		img = imaging.Rotate180(img)
+		hasChanges = true
+	case 270:
+		img = imaging.Rotate90(img)
+		hasChanges = true
+	}
+
+	if strings.Contains(pFlip, "h") {
+		img = imaging.FlipH(img)
+		hasChanges = true
+	}
+
+	if strings.Contains(pFlip, "v") {
+		img = imaging.FlipV(img)
+		hasChanges = true
+	}
+
 	imgBounds := img.Bounds().Max
 
 	if pW > 0 || pH > 0 {
@@ -102,11 +430,30 @@ func (c *Img) Handle(fPath string, w io.Writer, pars *types.ImgParsSt) error {
 			}
 		}
 
-		if imgBounds.X > pW || imgBounds.Y > pH {
+		if pM == "pad" {
+			// canvas is allocated, derived side may be much larger than requested one
+			err = c.checkCanvasSize(pW, pH)
+			if err != nil {
+				return err
+			}
+
+			if imgBounds.X > pW || imgBounds.Y > pH {
+				img = imaging.Fit(img, pW, pH, imaging.Lanczos)
+			}
+
+			bgColor, _ := parseHexColor(pars.BgColor)
+			if pars.BgColor == "" && (imgFormat.format == imaging.JPEG || imgFormat.format == imaging.BMP) {
+				bgColor = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff} // formats without alpha channel
+			}
+
+			img = imaging.OverlayCenter(imaging.New(pW, pH, bgColor), img, 1)
+
+			imgBounds = img.Bounds().Max
+		} else if imgBounds.X > pW || imgBounds.Y > pH {
 			if pM == "fit" {
 				img = imaging.Fit(img, pW, pH, imaging.Lanczos)
 			} else {
-				img = imaging.Fill(img, pW, pH, imaging.Center, imaging.Lanczos)
+				img = imaging.Fill(img, pW, pH, imgGravities[pars.Gravity], imaging.Lanczos)
 			}
 
 			imgBounds = img.Bounds().Max
@@ -115,12 +462,39 @@ func (c *Img) Handle(fPath string, w io.Writer, pars *types.ImgParsSt) error {
 		hasChanges = true
 	}
 
+	if pars.Brightness != 0 {
+		img = imaging.AdjustBrightness(img, pars.Brightness)
+		hasChanges = true
+	}
+
+	if pars.Contrast != 0 {
+		img = imaging.AdjustContrast(img, pars.Contrast)
+		hasChanges = true
+	}
+
+	if pars.Gamma != 0 && pars.Gamma != 1 {
+		img = imaging.AdjustGamma(img, pars.Gamma)
+		hasChanges = true
+	}
+
+	if pars.Saturation != 0 {
+		img = imaging.AdjustSaturation(img, pars.Saturation)
+		hasChanges = true
+	}
+
 	if pBlur != 0 {
 		img = imaging.Blur(img, pBlur)
+		hasChanges = true
+	}
+
+	if pSharpen != 0 {
+		img = imaging.Sharpen(img, pSharpen)
+		hasChanges = true
 	}
 
 	if pGrayscale {
 		img = imaging.Grayscale(img)
+		hasChanges = true
 	}
 
 	if pWMark && c.wMark != nil {
@@ -134,20 +508,214 @@ func (c *Img) Handle(fPath string, w io.Writer, pars *types.ImgParsSt) error {
 	}
 
 	if hasChanges {
-		if w == nil {
-			err = imaging.Save(img, fPath)
-			if err != nil {
-				c.r.lg.Errorw("Fail to save image", err)
-				return err
+		err = c.encode(w, img, imgFormat.format, pars.Quality)
+		if err != nil {
+			c.r.lg.Errorw("Fail to encode image", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Img) GetQueueStats() *types.ImgQueueStatsSt {
+	return &types.ImgQueueStatsSt{
+		Concurrency: cap(c.queue),
+		Running:     int64(len(c.queue)),
+		Waiting:     atomic.LoadInt64(&c.queueWaiting),
+		Timeouts:    atomic.LoadInt64(&c.queueTimeouts),
+	}
+}
+
+// acquireSlot waits for a free slot to limit count of parallel transformations
+func (c *Img) acquireSlot() error {
+	if c.queue == nil {
+		return nil
+	}
+
+	// fast path
+	select {
+	case c.queue <- struct{}{}:
+		return nil
+	default:
+	}
+
+	atomic.AddInt64(&c.queueWaiting, 1)
+	defer atomic.AddInt64(&c.queueWaiting, -1)
+
+	var timeoutCh <-chan time.Time
+
+	if c.queueTimeout > 0 {
+		timer := time.NewTimer(c.queueTimeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case c.queue <- struct{}{}:
+		return nil
+	case <-timeoutCh:
+		atomic.AddInt64(&c.queueTimeouts, 1)
+		return errs.ImageQueueTimeout
+	}
+}
+
+func (c *Img) releaseSlot() {
+	if c.queue != nil {
+		<-c.queue
+	}
+}
+
+// parseHexColor parses "rgb", "rgba", "rrggbb" or "rrggbbaa" with optional "#" prefix,
+// empty value is transparent
+func parseHexColor(v string) (color.NRGBA, error) {
+	v = strings.TrimPrefix(v, "#")
+
+	switch len(v) {
+	case 0:
+		return color.NRGBA{}, nil
+	case 3, 4:
+		// expand short form
+		var sb strings.Builder
+		for _, ch := range v {
+			sb.WriteRune(ch)
+			sb.WriteRune(ch)
+		}
+		v = sb.String()
+	case 6, 8:
+	default:
+		return color.NRGBA{}, errors.New("bad color length")
+	}
+
+	if len(v) == 6 {
+		v += "ff"
+	}
+
+	n, err := strconv.ParseUint(v, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+
+	return color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, nil
+}
+
+func (c *Img) encode(w io.Writer, img image.Image, format imaging.Format, quality int) error {
+	if quality == 0 {
+		quality = c.qualityDefault
+	}
+	if c.qualityMax > 0 && quality > c.qualityMax {
+		quality = c.qualityMax
+	}
+
+	switch format {
+	case imgFormatWebP:
+		// 0 - library default
+		return webp.Encode(w, img, webp.Options{Quality: quality})
+	case imaging.PNG:
+		// png is lossless, quality sets the compression level: the lower quality - the smaller file
+		compressionLevel := png.DefaultCompression
+		switch {
+		case quality == 0:
+		case quality <= 33:
+			compressionLevel = png.BestCompression
+		case quality > 66:
+			compressionLevel = png.BestSpeed
+		}
+		return imaging.Encode(w, img, format, imaging.PNGCompressionLevel(compressionLevel))
+	case imaging.JPEG:
+		if quality > 0 {
+			return imaging.Encode(w, img, format, imaging.JPEGQuality(quality))
+		}
+	}
+
+	return imaging.Encode(w, img, format)
+}
+
+// readExifOrientation returns exif orientation (1-8) of jpeg image, 0 if it is not found
+func readExifOrientation(r io.Reader) int {
+	const (
+		markerSOI  = 0xffd8
+		markerAPP1 = 0xffe1
+		markerSOS  = 0xffda
+	)
+
+	br := bufio.NewReader(r)
+
+	var soi uint16
+	if binary.Read(br, binary.BigEndian, &soi) != nil || soi != markerSOI {
+		return 0
+	}
+
+	// exif is in APP1 segment, segments with metadata are before image data (SOS)
+	for {
+		var marker, size uint16
+		if binary.Read(br, binary.BigEndian, &marker) != nil || binary.Read(br, binary.BigEndian, &size) != nil {
+			return 0
+		}
+		if marker>>8 != 0xff || marker == markerSOS || size < 2 {
+			return 0
+		}
+
+		if marker != markerAPP1 {
+			if _, err := br.Discard(int(size) - 2); err != nil {
+				return 0
 			}
-		} else {
-			err = imaging.Encode(w, img, imgFormat.format)
-			if err != nil {
-				c.r.lg.Errorw("Fail to encode image", err)
-				return err
+			continue
+		}
+
+		data := make([]byte, size-2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return 0
+		}
+
+		// APP1 may also contain xmp
+		if v := parseExifOrientation(data); v > 0 {
+			return v
+		}
+	}
+}
+
+// parseExifOrientation finds orientation tag in IFD0 of exif data of APP1 segment
+func parseExifOrientation(data []byte) int {
+	const orientationTag = 0x0112
+
+	if len(data) < 14 || string(data[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+
+	tiff := data[6:]
+
+	var byteOrder binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		byteOrder = binary.LittleEndian
+	case "MM":
+		byteOrder = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifdOffset := int64(byteOrder.Uint32(tiff[4:8]))
+	if ifdOffset < 8 || ifdOffset+2 > int64(len(tiff)) {
+		return 0
+	}
+
+	tagCount := int64(byteOrder.Uint16(tiff[ifdOffset:]))
+
+	for i := int64(0); i < tagCount; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > int64(len(tiff)) {
+			return 0
+		}
+
+		if byteOrder.Uint16(tiff[entry:]) == orientationTag {
+			if v := int(byteOrder.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
 			}
+			return 0
 		}
 	}
 
-	return nil
+	return 0
 }
@@ -6,69 +6,102 @@ import (
 
 	"github.com/rendau/dop/adapters/logger"
 	"github.com/rendau/fs/internal/adapters/cleaner"
+	"github.com/rendau/fs/internal/adapters/storage"
+	"github.com/rendau/fs/internal/domain/types"
 	"github.com/rendau/fs/internal/domain/util"
 )
 
 type St struct {
 	lg            logger.Lite
-	dirPath       string
+	storage       storage.Storage
 	imgMaxWidth   int
 	imgMaxHeight  int
 	wMarkDirPaths []string
 	testing       bool
 
-	Static *Static
-	Img    *Img
-	Zip    *Zip
-	Cache  *Cache
-	Clean  *Clean
-	Kvs    *Kvs
+	Static    *Static
+	Img       *Img
+	Zip       *Zip
+	Cache     *Cache
+	DiskCache *DiskCache
+	Clean     *Clean
+	Kvs       *Kvs
+	Auth      *Auth
+	Sign      *Sign
 
 	wg     sync.WaitGroup
 	stop   bool
 	stopMu sync.RWMutex
 }
 
+// ConfSt is configuration of core, zero values disable corresponding features
+type ConfSt struct {
+	ImgMaxWidth       int // uploaded images are downscaled to fit ImgMaxWidth x ImgMaxHeight
+	ImgMaxHeight      int
+	ImgAutoFormat     bool
+	ImgQualityDefault int
+	ImgQualityMax     int
+	ImgLimits         types.ImgLimitsSt
+	ImgConcurrency    int
+	ImgQueueTimeout   time.Duration
+	WMarkPath         string
+	WMarkOpacity      float64
+	WMarkDirPaths     []string
+	ZipLimits         types.ZipLimitsSt
+	AuthApiKeys       map[string]*types.AuthScopeSt
+	AuthJwtSecret     string
+	UrlSignSecret     string
+	PrivateDirPaths   []string
+	CacheCount        int
+	CacheSize         int64
+	CacheMaxEntrySize int64
+	CacheTtl          time.Duration
+	DiskCacheSize     int64
+	DiskCacheTtl      time.Duration
+}
+
+// New creates core.
+// diskCacheStorage is optional, disk cache is disabled if it is nil.
+// If testing is true, background jobs are run synchronously.
 func New(
 	lg logger.Lite,
 	cleaner cleaner.Cleaner,
-	dirPath string,
-	imgMaxWidth int,
-	imgMaxHeight int,
-	wMarkPath string,
-	wMarkOpacity float64,
-	wMarkDirPaths []string,
-	cacheCount int,
-	cacheTtl time.Duration,
+	storage storage.Storage,
+	diskCacheStorage storage.Storage,
+	conf ConfSt,
 	testing bool,
 ) *St {
 	c := &St{
 		lg:            lg,
-		dirPath:       dirPath,
-		imgMaxWidth:   imgMaxWidth,
-		imgMaxHeight:  imgMaxHeight,
-		wMarkDirPaths: wMarkDirPaths,
+		storage:       storage,
+		imgMaxWidth:   conf.ImgMaxWidth,
+		imgMaxHeight:  conf.ImgMaxHeight,
+		wMarkDirPaths: make([]string, len(conf.WMarkDirPaths)),
 		testing:       testing,
 	}
 
-	for i := range c.wMarkDirPaths {
-		c.wMarkDirPaths[i] = util.ToFsPath(c.wMarkDirPaths[i])
+	for i := range conf.WMarkDirPaths {
+		c.wMarkDirPaths[i] = util.ToStoragePath(conf.WMarkDirPaths[i])
 	}
 
-	c.Static = NewStatic(c)
-	c.Img = NewImg(c, wMarkPath, wMarkOpacity)
-	c.Zip = NewZip(c)
-	c.Cache = NewCache(c, cacheCount, cacheTtl)
+	c.Static = NewStatic(c, NewCache(c, conf.CacheCount, conf.CacheSize, conf.CacheMaxEntrySize, conf.CacheTtl))
+	c.Img = NewImg(c, conf.ImgAutoFormat, conf.ImgQualityDefault, conf.ImgQualityMax, conf.ImgLimits, conf.ImgConcurrency, conf.ImgQueueTimeout, conf.WMarkPath, conf.WMarkOpacity)
+	c.Zip = NewZip(c, conf.ZipLimits)
+	c.Cache = NewCache(c, conf.CacheCount, conf.CacheSize, conf.CacheMaxEntrySize, conf.CacheTtl)
+	c.DiskCache = NewDiskCache(c, diskCacheStorage, conf.DiskCacheSize, conf.DiskCacheTtl)
 	c.Clean = NewClean(c, cleaner)
 	c.Kvs = NewKvs(c)
+	c.Auth = NewAuth(c, conf.AuthApiKeys, conf.AuthJwtSecret)
+	c.Sign = NewSign(c, conf.UrlSignSecret, conf.PrivateDirPaths)
 
 	return c
 }
 
 func (c *St) Start() {
 	c.Img.Start()
+	c.Static.Start()
 	c.Cache.Start()
-	c.Kvs.Start()
+	c.DiskCache.Start()
 }
 
 func (c *St) StopAndWaitJobs() {
@@ -1,9 +1,10 @@
 package core
 
 import (
+	"errors"
 	"io"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"path"
 	"sync"
 	"time"
 
@@ -23,27 +24,13 @@ func NewKvs(r *St) *Kvs {
 	}
 }
 
-func (c *Kvs) Start() {
-	err := os.MkdirAll(filepath.Join(c.r.dirPath, cns.KvsDirNamePrefix), os.ModePerm)
-	if err != nil {
-		c.r.lg.Errorw("Fail to create kvs-dir", err)
-	}
-}
-
 func (c *Kvs) Set(key string, file io.Reader) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	f, err := os.Create(c.generateAbsFilePath(key))
-	if err != nil {
-		c.r.lg.Errorw("Fail to create file", err)
-		return err
-	}
-	defer f.Close()
-
-	_, err = io.Copy(f, file)
+	err := c.r.storage.Put(c.generateFilePath(key), file)
 	if err != nil {
-		c.r.lg.Errorw("Fail to copy data", err)
+		c.r.lg.Errorw("Fail to put file", err)
 		return err
 	}
 
@@ -54,21 +41,28 @@ func (c *Kvs) Get(key string) ([]byte, time.Time, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	filePath := c.generateAbsFilePath(key)
+	filePath := c.generateFilePath(key)
 
 	fModTime := time.Now()
 
-	fStat, err := os.Stat(filePath)
+	fStat, err := c.r.storage.Stat(filePath)
 	if err != nil {
-		if !os.IsNotExist(err) {
+		if !errors.Is(err, fs.ErrNotExist) {
 			c.r.lg.Errorw("Fail to get stat of file", err, "f_path", filePath)
 		}
 		return nil, fModTime, dopErrs.ObjectNotFound
 	}
 
-	fModTime = fStat.ModTime()
+	fModTime = fStat.ModTime
+
+	f, err := c.r.storage.Get(filePath)
+	if err != nil {
+		c.r.lg.Errorw("Fail to open file", err)
+		return nil, fModTime, err
+	}
+	defer f.Close()
 
-	fData, err := os.ReadFile(filePath)
+	fData, err := io.ReadAll(f)
 	if err != nil {
 		c.r.lg.Errorw("Fail to read file", err)
 		return nil, fModTime, err
@@ -81,15 +75,15 @@ func (c *Kvs) Remove(key string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	err := os.RemoveAll(c.generateAbsFilePath(key))
+	err := c.r.storage.Remove(c.generateFilePath(key))
 	if err != nil {
-		c.r.lg.Errorw("Fail to create file", err)
+		c.r.lg.Errorw("Fail to remove file", err)
 		return err
 	}
 
 	return nil
 }
 
-func (c *Kvs) generateAbsFilePath(key string) string {
-	return filepath.Join(c.r.dirPath, cns.KvsDirNamePrefix, util.ToFsPath(key))
+func (c *Kvs) generateFilePath(key string) string {
+	return path.Join(cns.KvsDirNamePrefix, util.ToStoragePath(key))
 }
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rendau/fs/internal/cns"
+	"github.com/rendau/fs/internal/domain/errs"
+	"github.com/rendau/fs/internal/domain/util"
+)
+
+const (
+	signQueryParamExp = "exp"
+	signQueryParamSig = "sig"
+)
+
+type Sign struct {
+	r               *St
+	secret          []byte
+	privateDirPaths []string
+}
+
+func NewSign(r *St, secret string, privateDirPaths []string) *Sign {
+	c := &Sign{
+		r:               r,
+		secret:          []byte(secret),
+		privateDirPaths: make([]string, 0, len(privateDirPaths)),
+	}
+
+	for _, p := range privateDirPaths {
+		if p = util.ToStoragePath(p); p != "" {
+			c.privateDirPaths = append(c.privateDirPaths, p)
+		}
+	}
+
+	return c
+}
+
+func (c *Sign) IsPrivate(reqPath string) bool {
+	reqStPath := util.ToStoragePath(reqPath)
+
+	for _, p := range c.privateDirPaths {
+		if reqStPath == p || strings.HasPrefix(reqStPath, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Create returns query params (with expiration time and signature) for url of reqPath.
+// If boundQuery is not empty, url will be valid only with exactly these extra params (e.g. w, h).
+func (c *Sign) Create(reqPath string, ttl time.Duration, boundQuery url.Values) (url.Values, error) {
+	if len(c.secret) == 0 {
+		return nil, errs.SignNotConfigured
+	}
+
+	if ttl <= 0 {
+		ttl = cns.DefaultUrlSignTtl
+	}
+
+	result := url.Values{}
+
+	for k, v := range boundQuery {
+		if k != signQueryParamExp && k != signQueryParamSig {
+			result[k] = v
+		}
+	}
+
+	result.Set(signQueryParamExp, strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+
+	result.Set(signQueryParamSig, c.generate(reqPath, result))
+
+	return result, nil
+}
+
+func (c *Sign) Check(reqPath string, query url.Values) error {
+	sig := query.Get(signQueryParamSig)
+	if sig == "" || len(c.secret) == 0 {
+		return errs.BadSignature
+	}
+
+	exp, err := strconv.ParseInt(query.Get(signQueryParamExp), 10, 64)
+	if err != nil {
+		return errs.BadSignature
+	}
+
+	signedQuery := url.Values{}
+	for k, v := range query {
+		if k != signQueryParamSig {
+			signedQuery[k] = v
+		}
+	}
+
+	// bound to all query params, or only to expiration time
+	if !hmac.Equal([]byte(sig), []byte(c.generate(reqPath, signedQuery))) &&
+		!hmac.Equal([]byte(sig), []byte(c.generate(reqPath, url.Values{signQueryParamExp: {query.Get(signQueryParamExp)}}))) {
+		return errs.BadSignature
+	}
+
+	if time.Now().Unix() > exp {
+		return errs.SignatureExpired
+	}
+
+	return nil
+}
+
+func (c *Sign) generate(reqPath string, query url.Values) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(util.ToStoragePath(reqPath) + "?" + query.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
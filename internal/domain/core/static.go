@@ -2,31 +2,67 @@ package core
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/rendau/dop/dopErrs"
+	"github.com/rendau/fs/internal/adapters/storage"
 	"github.com/rendau/fs/internal/cns"
 	"github.com/rendau/fs/internal/domain/errs"
 	"github.com/rendau/fs/internal/domain/types"
 	"github.com/rendau/fs/internal/domain/util"
+	"golang.org/x/sync/singleflight"
 )
 
+const uniqueNameMaxAttempts = 100
+
+// depth of date dirs created by Create: yyyy/mm/dd
+const dateDirDepth = 3
+
+type writeCounterSt struct {
+	n int64
+}
+
+func (w *writeCounterSt) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
 type Static struct {
 	r *St
+
+	// metas and upload-metas of files, separate from derivatives in Cache
+	metaCache *Cache
+
+	// deduplicates concurrent transformations by cache-key
+	handleGroup singleflight.Group
 }
 
-func NewStatic(r *St) *Static {
+func NewStatic(r *St, metaCache *Cache) *Static {
 	return &Static{
-		r: r,
+		r:         r,
+		metaCache: metaCache,
 	}
 }
 
-func (c *Static) Create(reqDir string, reqFileName string, reqFile io.Reader, noCut bool, unZip bool) (string, error) {
+func (c *Static) Start() {
+	c.metaCache.Start()
+}
+
+// Create saves file into date dir of reqDir.
+// uploadMeta (optional) is completed with file info and stored alongside of file.
+func (c *Static) Create(reqDir string, reqFileName string, reqFile io.Reader, noCut bool, unZip bool, uploadMeta *types.StaticUploadMetaSt) (string, error) {
 	reqDirUrlPath := util.ToUrlPath(reqDir)
 
 	if strings.Contains("/"+reqDirUrlPath, "/"+cns.ZipDirNamePrefix) {
@@ -37,74 +73,118 @@ func (c *Static) Create(reqDir string, reqFileName string, reqFile io.Reader, no
 		return "", errs.BadDirName
 	}
 
-	dateUrlPath := util.GetDateUrlPath()
-
-	absFsDirPath := filepath.Join(c.r.dirPath, util.ToFsPath(reqDir), util.ToFsPath(dateUrlPath))
+	if strings.HasPrefix("/"+reqDirUrlPath, "/"+cns.MetaDirNamePrefix) {
+		return "", errs.BadDirName
+	}
 
-	err := os.MkdirAll(absFsDirPath, os.ModePerm)
-	if err != nil {
-		c.r.lg.Errorw("Fail to create dirs", err)
-		return "", err
+	if uploadMeta == nil {
+		uploadMeta = &types.StaticUploadMetaSt{}
 	}
 
-	reqFileExt := strings.ToLower(filepath.Ext(reqFileName))
+	hash := sha256.New()
+	counter := &writeCounterSt{}
 
-	var targetFsPath string
+	reqFile = io.TeeReader(reqFile, io.MultiWriter(hash, counter))
+
+	dateUrlPath := util.GetDateUrlPath()
+
+	dirPath := path.Join(util.ToStoragePath(reqDir), dateUrlPath)
+
+	reqFileExt := strings.ToLower(path.Ext(reqFileName))
+
+	var targetPath string
 	var isZipDir bool
+	var err error
 
 	if unZip && reqFileExt == ".zip" {
-		targetFsPath, err = os.MkdirTemp(absFsDirPath, cns.ZipDirNamePrefix+"*")
+		targetPath, err = c.generateUniquePath(dirPath, cns.ZipDirNamePrefix, "")
 		if err != nil {
-			c.r.lg.Errorw("Fail to create temp-dir", err)
 			return "", err
 		}
 
-		err = c.r.Zip.Extract(reqFile, targetFsPath)
+		err = c.r.Zip.Extract(reqFile, targetPath)
 		if err != nil {
+			if rmErr := c.r.storage.Remove(targetPath); rmErr != nil {
+				c.r.lg.Errorw("Fail to remove zip-dir", rmErr, "path", targetPath)
+			}
 			return "", err
 		}
 
 		isZipDir = true
 	} else {
-		targetFsPath, err = func() (string, error) {
-			f, err := os.CreateTemp(absFsDirPath, "*"+reqFileExt)
-			if err != nil {
-				c.r.lg.Errorw("Fail to create temp-file", err)
-				return "", err
-			}
-			defer f.Close()
-
-			_, err = io.Copy(f, reqFile)
-			if err != nil {
-				c.r.lg.Errorw("Fail to copy data", err)
-				return "", err
-			}
+		targetPath, err = c.generateUniquePath(dirPath, "", reqFileExt)
+		if err != nil {
+			return "", err
+		}
 
-			return f.Name(), nil
-		}()
+		err = c.r.storage.Put(targetPath, reqFile)
 		if err != nil {
+			c.r.lg.Errorw("Fail to put file", err, "path", targetPath)
+			if rmErr := c.r.storage.Remove(targetPath); rmErr != nil {
+				c.r.lg.Errorw("Fail to remove file", rmErr, "path", targetPath)
+			}
 			return "", err
 		}
 
 		if !noCut {
-			err = c.r.Img.Handle(targetFsPath, nil, &types.ImgParsSt{
+			buffer := new(bytes.Buffer)
+
+			err = c.r.Img.HandleUpload(targetPath, buffer, &types.ImgParsSt{
 				Method: "fit",
 				Width:  c.r.imgMaxWidth,
 				Height: c.r.imgMaxHeight,
 			})
+			if err == errs.ImageSourceTooLarge {
+				c.r.lg.Warnw("Uploaded image is too large to downscale, stored as is", "path", targetPath)
+				err = nil
+			}
 			if err != nil {
+				if rmErr := c.r.storage.Remove(targetPath); rmErr != nil {
+					c.r.lg.Errorw("Fail to remove file", rmErr, "path", targetPath)
+				}
 				return "", err
 			}
+
+			if buffer.Len() > 0 {
+				// stored file differs from uploaded one
+				hash.Reset()
+				hash.Write(buffer.Bytes())
+				counter.n = int64(buffer.Len())
+
+				err = c.r.storage.Put(targetPath, buffer)
+				if err != nil {
+					c.r.lg.Errorw("Fail to put file", err, "path", targetPath)
+					if rmErr := c.r.storage.Remove(targetPath); rmErr != nil {
+						c.r.lg.Errorw("Fail to remove file", rmErr, "path", targetPath)
+					}
+					return "", err
+				}
+			}
 		}
 	}
 
-	fileFsRelPath, err := filepath.Rel(c.r.dirPath, targetFsPath)
+	uploadMeta.OriginalName = path.Base(util.ToUrlPath(reqFileName))
+	uploadMeta.Size = counter.n
+	uploadMeta.Sha256 = hex.EncodeToString(hash.Sum(nil))
+	uploadMeta.CreatedAt = time.Now()
+
+	if contentType, ok := c.r.Img.GetContentType(reqFileName); ok {
+		uploadMeta.ContentType = contentType
+	} else if contentType = mime.TypeByExtension(reqFileExt); contentType != "" {
+		uploadMeta.ContentType = contentType
+	} else {
+		uploadMeta.ContentType = "application/octet-stream"
+	}
+
+	err = c.putUploadMeta(targetPath, uploadMeta)
 	if err != nil {
-		c.r.lg.Errorw("Fail to get relative path", err, "path", targetFsPath, "base", c.r.dirPath)
+		if rmErr := c.r.storage.Remove(targetPath); rmErr != nil {
+			c.r.lg.Errorw("Fail to remove path", rmErr, "path", targetPath)
+		}
 		return "", err
 	}
 
-	fileUrlRelPath := util.ToUrlPath(fileFsRelPath)
+	fileUrlRelPath := targetPath
 
 	if isZipDir {
 		fileUrlRelPath += "/"
@@ -113,88 +193,551 @@ func (c *Static) Create(reqDir string, reqFileName string, reqFile io.Reader, no
 	return fileUrlRelPath, nil
 }
 
-func (c *Static) Get(reqPath string, imgPars *types.ImgParsSt, download bool) (string, time.Time, []byte, error) {
+func (c *Static) Get(reqPath string, imgPars *types.ImgParsSt, download bool) (*types.StaticFileSt, error) {
 	var err error
 
-	cKey := c.r.Cache.GenerateKey(reqPath, imgPars, download)
-
-	if name, modTime, content := c.r.Cache.GetAndRefresh(cKey); content != nil {
-		return name, modTime, content, nil
+	err = c.r.Img.PreparePars(imgPars)
+	if err != nil {
+		return nil, err
 	}
 
-	reqFsPath := util.ToFsPath(reqPath)
-	absFsPath := filepath.Join(c.r.dirPath, reqFsPath)
+	reqStPath := util.ToStoragePath(reqPath)
+	stPath := reqStPath
+
+	if isInternalPath(stPath) {
+		return nil, dopErrs.ObjectNotFound
+	}
 
-	name := ""
-	modTime := time.Now()
-	content := make([]byte, 0)
+	result := &types.StaticFileSt{
+		ModTime: time.Now(),
+	}
 
-	fInfo, err := os.Stat(absFsPath)
+	fInfo, err := c.r.storage.Stat(stPath)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			c.r.lg.Errorw("Fail to get stat of file", err, "f_path", absFsPath)
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.r.lg.Errorw("Fail to get stat of file", err, "f_path", stPath)
+		}
+		return nil, dopErrs.ObjectNotFound
+	}
+
+	// zip-dirs and their content have no original name
+	if !download && !fInfo.IsDir {
+		if uploadMeta := c.getUploadMeta(stPath, fInfo.ModTime); uploadMeta != nil {
+			result.OriginalName = uploadMeta.OriginalName
 		}
-		return "", modTime, nil, dopErrs.ObjectNotFound
+	}
+
+	cKey := c.r.Cache.GenerateKey(reqPath, imgPars, download)
+
+	if name, modTime, content := c.r.Cache.GetAndRefresh(cKey, fInfo.ModTime); content != nil {
+		return &types.StaticFileSt{
+			Name:         name,
+			OriginalName: result.OriginalName,
+			ModTime:      modTime,
+			Content:      storage.NopCloser(bytes.NewReader(content)),
+		}, nil
 	}
 
 	if !download {
-		modTime = fInfo.ModTime()
+		result.ModTime = fInfo.ModTime
 	}
 
-	if fInfo.IsDir() {
-		dirName := filepath.Base(absFsPath)
+	if fInfo.IsDir {
+		dirName := path.Base(stPath)
 
 		if strings.HasPrefix(dirName, cns.ZipDirNamePrefix) {
 			if download {
-				archiveBuffer, err := c.r.Zip.CompressDir(absFsPath)
-				if err != nil {
-					return "", modTime, nil, err
+				result.Name = "archive.zip"
+				result.WriteTo = func(w io.Writer) error {
+					return c.r.Zip.CompressDir(stPath, w)
 				}
 
-				return "archive.zip", modTime, archiveBuffer.Bytes(), nil
+				return result, nil
 			} else if strings.HasSuffix(reqPath, "/") {
-				absFsPath = filepath.Join(absFsPath, "index.html")
-				name = "index.html"
+				stPath = path.Join(stPath, "index.html")
+				result.Name = "index.html"
 				imgPars.Reset()
 			} else {
-				return "", modTime, nil, dopErrs.ObjectNotFound
+				return nil, dopErrs.ObjectNotFound
 			}
 		} else {
-			return "", modTime, nil, dopErrs.ObjectNotFound
+			return nil, dopErrs.ObjectNotFound
 		}
 	} else {
-		_, name = filepath.Split(absFsPath)
+		result.Name = path.Base(stPath)
 	}
 
 	for _, p := range c.r.wMarkDirPaths {
-		if strings.HasPrefix(reqFsPath, p) {
+		if strings.HasPrefix(reqStPath, p) {
 			imgPars.WMark = true
 			break
 		}
 	}
 
 	if !imgPars.IsEmpty() {
-		buffer := new(bytes.Buffer)
+		content, err, _ := c.handleGroup.Do(cKey, func() (any, error) {
+			outName := c.r.Img.GetOutputName(result.Name, imgPars)
+
+			dcKey := c.r.DiskCache.GenerateKey(cKey, fInfo.ModTime)
+
+			if content := c.r.DiskCache.Get(dcKey); content != nil {
+				c.r.Cache.Set(cKey, outName, result.ModTime, fInfo.ModTime, content)
+				return content, nil
+			}
+
+			buffer := new(bytes.Buffer)
+
+			err := c.r.Img.Handle(stPath, buffer, imgPars)
+			if err != nil {
+				return nil, err
+			}
+
+			if buffer.Len() > 0 {
+				c.r.Cache.Set(cKey, outName, result.ModTime, fInfo.ModTime, buffer.Bytes())
+				c.r.DiskCache.Set(dcKey, buffer.Bytes())
+			}
+
+			return buffer.Bytes(), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if content := content.([]byte); len(content) > 0 {
+			result.Name = c.r.Img.GetOutputName(result.Name, imgPars)
+			result.Content = storage.NopCloser(bytes.NewReader(content))
+
+			return result, nil
+		}
+	}
+
+	result.Content, err = c.r.storage.Get(stPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, dopErrs.ObjectNotFound
+		}
+		c.r.lg.Errorw("Fail to open file", err, "f_path", stPath)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetMeta returns metadata of file, result is cached until file is changed
+func (c *Static) GetMeta(reqPath string) (*types.StaticMetaSt, error) {
+	stPath := util.ToStoragePath(reqPath)
+
+	if isInternalPath(stPath) {
+		return nil, dopErrs.ObjectNotFound
+	}
+
+	fInfo, err := c.r.storage.Stat(stPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.r.lg.Errorw("Fail to get stat of file", err, "f_path", stPath)
+		}
+		return nil, dopErrs.ObjectNotFound
+	}
+
+	if fInfo.IsDir {
+		return nil, dopErrs.ObjectNotFound
+	}
+
+	cKey := c.metaCache.GenerateMetaKey(stPath)
+
+	if _, _, content := c.metaCache.GetAndRefresh(cKey, fInfo.ModTime); content != nil {
+		result := &types.StaticMetaSt{}
+		if err = json.Unmarshal(content, result); err == nil {
+			return result, nil
+		}
+		c.r.lg.Errorw("Fail to unmarshal cached meta", err, "f_path", stPath)
+	}
+
+	result := &types.StaticMetaSt{
+		Name:    path.Base(stPath),
+		Size:    fInfo.Size,
+		ModTime: fInfo.ModTime,
+	}
+
+	uploadMeta := c.getUploadMeta(stPath, fInfo.ModTime)
+
+	// checksum of upload is valid while file is not changed
+	if uploadMeta != nil && uploadMeta.Sha256 != "" && uploadMeta.Size == fInfo.Size && !fInfo.ModTime.After(uploadMeta.CreatedAt) {
+		result.Sha256 = uploadMeta.Sha256
+	}
+
+	imgContentType, isImg := c.r.Img.GetContentType(stPath)
+	extContentType := mime.TypeByExtension(path.Ext(stPath))
+
+	var head []byte
+
+	// content is read only for checksum or content-type sniffing
+	if result.Sha256 == "" || (!isImg && extContentType == "") {
+		var fileSha256 string
+
+		head, fileSha256, err = c.readFileHead(stPath, result.Sha256 == "")
+		if err != nil {
+			return nil, err
+		}
+
+		if fileSha256 != "" {
+			result.Sha256 = fileSha256
+		}
+	}
+
+	switch {
+	case isImg:
+		result.ContentType = imgContentType
+
+		result.Width, result.Height, err = c.r.Img.GetSize(stPath)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case result.Width == 0 || result.Height == 0:
+		case result.Width > result.Height:
+			result.Orientation = "landscape"
+		case result.Width < result.Height:
+			result.Orientation = "portrait"
+		default:
+			result.Orientation = "square"
+		}
+	case extContentType != "":
+		result.ContentType = extContentType
+	default:
+		result.ContentType = http.DetectContentType(head)
+	}
+
+	// uploader and tags are not public
+	if uploadMeta != nil {
+		result.OriginalName = uploadMeta.OriginalName
+	}
+
+	if content, err := json.Marshal(result); err == nil {
+		c.metaCache.Set(cKey, result.Name, fInfo.ModTime, fInfo.ModTime, content)
+	}
+
+	return result, nil
+}
+
+// readFileHead returns first 512 bytes of file (for content-type sniffing) and sha256 of whole file if withSha256
+func (c *Static) readFileHead(stPath string, withSha256 bool) ([]byte, string, error) {
+	f, err := c.r.storage.Get(stPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, "", dopErrs.ObjectNotFound
+		}
+		c.r.lg.Errorw("Fail to open file", err, "f_path", stPath)
+		return nil, "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		c.r.lg.Errorw("Fail to read file", err, "f_path", stPath)
+		return nil, "", err
+	}
+	head = head[:n]
+
+	if !withSha256 {
+		return head, "", nil
+	}
+
+	hash := sha256.New()
+	hash.Write(head)
+
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		c.r.lg.Errorw("Fail to read file", err, "f_path", stPath)
+		return nil, "", err
+	}
+
+	return head, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// List returns page of entries in dir and total count of them
+func (c *Static) List(reqPath string, pars *types.StaticListParsSt) ([]*types.StaticListItemSt, int64, error) {
+	stPath := util.ToStoragePath(reqPath)
+	if stPath == "." {
+		stPath = ""
+	}
+
+	if isInternalPath(stPath) {
+		return nil, 0, errs.BadDirName
+	}
 
-		err = c.r.Img.Handle(absFsPath, buffer, imgPars)
+	var less func(a, b *types.StaticListItemSt) bool
+
+	switch pars.SortName {
+	case "", "name":
+		less = func(a, b *types.StaticListItemSt) bool { return a.Name < b.Name }
+	case "size":
+		less = func(a, b *types.StaticListItemSt) bool { return a.Size < b.Size }
+	case "mtime":
+		less = func(a, b *types.StaticListItemSt) bool { return a.ModTime.Before(b.ModTime) }
+	default:
+		return nil, 0, errs.BadListSort
+	}
+
+	if pars.PageSize <= 0 {
+		pars.PageSize = cns.StaticListDefaultPageSize
+	} else if pars.PageSize > cns.StaticListMaxPageSize {
+		pars.PageSize = cns.StaticListMaxPageSize
+	}
+
+	if pars.Page < 0 {
+		pars.Page = 0
+	}
+
+	if stPath != "" {
+		fInfo, err := c.r.storage.Stat(stPath)
 		if err != nil {
-			return "", modTime, nil, err
+			if !errors.Is(err, fs.ErrNotExist) {
+				c.r.lg.Errorw("Fail to get stat of file", err, "f_path", stPath)
+			}
+			return nil, 0, dopErrs.ObjectNotFound
+		}
+
+		if !fInfo.IsDir {
+			return nil, 0, dopErrs.ObjectNotFound
+		}
+	}
+
+	infos, err := c.r.storage.List(stPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, dopErrs.ObjectNotFound
+		}
+		c.r.lg.Errorw("Fail to list dir", err, "path", stPath)
+		return nil, 0, err
+	}
+
+	items := make([]*types.StaticListItemSt, 0, len(infos))
+
+	for _, info := range infos {
+		if info.IsDir && isInternalPath(info.Name) {
+			continue
+		}
+
+		item := &types.StaticListItemSt{
+			Name:     info.Name,
+			Path:     path.Join(stPath, info.Name),
+			ModTime:  info.ModTime,
+			IsDir:    info.IsDir,
+			IsZipDir: info.IsDir && strings.HasPrefix(info.Name, cns.ZipDirNamePrefix),
+		}
+
+		if item.IsZipDir {
+			item.Path += "/"
+		}
+
+		if !info.IsDir {
+			item.Size = info.Size
+		}
+
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if pars.SortDesc {
+			return less(items[j], items[i])
+		}
+		return less(items[i], items[j])
+	})
+
+	totalCount := int64(len(items))
+
+	offset := pars.Page * pars.PageSize
+	if offset >= totalCount {
+		return []*types.StaticListItemSt{}, totalCount, nil
+	}
+
+	end := offset + pars.PageSize
+	if end > totalCount {
+		end = totalCount
+	}
+
+	return items[offset:end], totalCount, nil
+}
+
+// Remove removes file or zip-dir, and then empty date dirs of it
+func (c *Static) Remove(reqPath string) error {
+	stPath := util.ToStoragePath(reqPath)
+
+	if stPath == "" || stPath == "." {
+		return errs.BadDirName
+	}
+
+	if isInternalPath(stPath) {
+		return errs.BadDirName
+	}
+
+	// files inside zip-dir can be removed only with whole zip-dir
+	if strings.Contains("/"+path.Dir(stPath), "/"+cns.ZipDirNamePrefix) {
+		return errs.BadDirName
+	}
+
+	fInfo, err := c.r.storage.Stat(stPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.r.lg.Errorw("Fail to get stat of file", err, "f_path", stPath)
+		}
+		return dopErrs.ObjectNotFound
+	}
+
+	if fInfo.IsDir && !strings.HasPrefix(fInfo.Name, cns.ZipDirNamePrefix) {
+		return errs.BadDirName
+	}
+
+	err = c.r.storage.Remove(stPath)
+	if err != nil {
+		c.r.lg.Errorw("Fail to remove path", err, "path", stPath)
+		return err
+	}
+
+	c.r.Cache.RemoveByPrefix(stPath)
+	c.r.DiskCache.RemoveByPrefix(stPath)
+
+	c.removeEmptyDateDirs(path.Dir(stPath))
+
+	c.RemoveUploadMeta(stPath)
+
+	return nil
+}
+
+// GetUploadMeta returns stored upload-meta of file or zip-dir, nil if file was not uploaded with meta
+func (c *Static) GetUploadMeta(reqPath string) (*types.StaticUploadMetaSt, error) {
+	stPath := util.ToStoragePath(reqPath)
+
+	fInfo, err := c.r.storage.Stat(stPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.r.lg.Errorw("Fail to get stat of file", err, "f_path", stPath)
 		}
+		return nil, dopErrs.ObjectNotFound
+	}
+
+	return c.getUploadMeta(stPath, fInfo.ModTime), nil
+}
+
+// RemoveUploadMeta removes stored upload-meta of file
+func (c *Static) RemoveUploadMeta(p string) {
+	c.metaCache.RemoveByPrefix(p)
+
+	metaPath := c.getUploadMetaPath(p)
+
+	err := c.r.storage.Remove(metaPath)
+	if err != nil {
+		c.r.lg.Errorw("Fail to remove upload-meta", err, "path", metaPath)
+		return
+	}
+
+	c.removeEmptyDateDirs(path.Dir(metaPath))
+}
+
+func (c *Static) putUploadMeta(p string, uploadMeta *types.StaticUploadMetaSt) error {
+	data, err := json.Marshal(uploadMeta)
+	if err != nil {
+		c.r.lg.Errorw("Fail to marshal upload-meta", err)
+		return err
+	}
+
+	err = c.r.storage.Put(c.getUploadMetaPath(p), bytes.NewReader(data))
+	if err != nil {
+		c.r.lg.Errorw("Fail to put upload-meta", err, "path", p)
+		return err
+	}
+
+	return nil
+}
+
+// getUploadMeta returns stored upload-meta of file or nil, result is cached until file is changed
+func (c *Static) getUploadMeta(p string, srcMt time.Time) *types.StaticUploadMetaSt {
+	cKey := c.metaCache.GenerateUploadMetaKey(p)
+
+	var data []byte
 
-		if buffer.Len() > 0 {
-			content = buffer.Bytes()
+	if _, _, content := c.metaCache.GetAndRefresh(cKey, srcMt); content != nil {
+		data = content
+	} else {
+		f, err := c.r.storage.Get(c.getUploadMetaPath(p))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				c.r.lg.Errorw("Fail to open upload-meta", err, "path", p)
+				return nil
+			}
+			data = []byte("null") // cached as absent
+		} else {
+			data, err = io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				c.r.lg.Errorw("Fail to read upload-meta", err, "path", p)
+				return nil
+			}
 		}
+
+		c.metaCache.Set(cKey, "", srcMt, srcMt, data)
+	}
+
+	var result *types.StaticUploadMetaSt
+
+	err := json.Unmarshal(data, &result)
+	if err != nil {
+		c.r.lg.Errorw("Fail to unmarshal upload-meta", err, "path", p)
+		return nil
 	}
 
-	if len(content) == 0 {
-		content, err = ioutil.ReadFile(absFsPath)
+	return result
+}
+
+// isInternalPath checks that storage path is inside of service dirs (kvs, upload-metas)
+func isInternalPath(stPath string) bool {
+	return strings.HasPrefix(stPath, cns.KvsDirNamePrefix) || strings.HasPrefix(stPath, cns.MetaDirNamePrefix)
+}
+
+func (c *Static) getUploadMetaPath(p string) string {
+	return path.Join(cns.MetaDirNamePrefix, util.ToStoragePath(p)) + ".json"
+}
+
+func (c *Static) removeEmptyDateDirs(dirPath string) {
+	for i := 0; i < dateDirDepth && dirPath != "." && dirPath != ""; i++ {
+		// non-recursive, so concurrent upload into the dir is never removed
+		err := c.r.storage.RemoveDir(dirPath)
 		if err != nil {
-			c.r.lg.Errorw("Fail to read file", err, "f_path", absFsPath)
-			return "", modTime, nil, err
+			if !errors.Is(err, fs.ErrExist) && !errors.Is(err, fs.ErrNotExist) {
+				c.r.lg.Errorw("Fail to remove dir", err, "path", dirPath)
+			}
+			return
 		}
+
+		dirPath = path.Dir(dirPath)
 	}
+}
 
-	c.r.Cache.Set(cKey, name, modTime, content)
+func (c *Static) generateUniquePath(dirPath string, prefix string, suffix string) (string, error) {
+	rnd := make([]byte, 8)
+
+	for i := 0; i < uniqueNameMaxAttempts; i++ {
+		_, err := rand.Read(rnd)
+		if err != nil {
+			c.r.lg.Errorw("Fail to generate random name", err)
+			return "", err
+		}
+
+		p := path.Join(dirPath, prefix+hex.EncodeToString(rnd)+suffix)
+
+		_, err = c.r.storage.Stat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return p, nil
+		}
+		if err != nil {
+			c.r.lg.Errorw("Fail to get stat of file", err, "f_path", p)
+			return "", err
+		}
+	}
 
-	return name, modTime, content, nil
+	return "", errors.New("fail to generate unique path")
 }
@@ -2,75 +2,50 @@ package core
 
 import (
 	"archive/zip"
-	"bytes"
+	"errors"
 	"io"
-	"io/ioutil"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
+
+	"github.com/rendau/dop/dopErrs"
+	"github.com/rendau/fs/internal/adapters/storage"
+	"github.com/rendau/fs/internal/cns"
+	"github.com/rendau/fs/internal/domain/errs"
+	"github.com/rendau/fs/internal/domain/types"
 )
 
 type Zip struct {
-	r *St
+	r      *St
+	limits types.ZipLimitsSt
 }
 
-func NewZip(r *St) *Zip {
+func NewZip(r *St, limits types.ZipLimitsSt) *Zip {
 	return &Zip{
-		r: r,
+		r:      r,
+		limits: limits,
 	}
 }
 
 func (c *Zip) Extract(archive io.Reader, dstDirPath string) error {
-	fileDataRaw, err := ioutil.ReadAll(archive)
+	archiveFile, err := c.spool(archive)
 	if err != nil {
-		c.r.lg.Errorw("Fail to read archive", err)
 		return err
 	}
+	defer func() {
+		_ = archiveFile.Close()
+		_ = os.Remove(archiveFile.Name())
+	}()
 
-	reader, err := zip.NewReader(bytes.NewReader(fileDataRaw), int64(len(fileDataRaw)))
+	archiveInfo, err := archiveFile.Stat()
 	if err != nil {
-		c.r.lg.Errorw("Fail to create zip-reader", err)
+		c.r.lg.Errorw("Fail to get stat of archive", err)
 		return err
 	}
 
-	fileHandler := func(f *zip.File, skipDirPrefix string) error {
-		dstPath := filepath.Join(dstDirPath, strings.TrimLeft(f.Name, skipDirPrefix))
-
-		if f.FileInfo().IsDir() {
-			err = os.MkdirAll(dstPath, f.Mode())
-			if err != nil {
-				c.r.lg.Errorw("Fail to create dirs", err)
-				return err
-			}
-		} else {
-			err = os.MkdirAll(filepath.Dir(dstPath), os.ModePerm)
-			if err != nil {
-				c.r.lg.Errorw("Fail to create dirs for file", err)
-				return err
-			}
-
-			srcFile, err := f.Open()
-			if err != nil {
-				c.r.lg.Errorw("Fail to open file in archive", err)
-				return err
-			}
-			defer srcFile.Close()
-
-			dstFile, err := os.Create(dstPath)
-			if err != nil {
-				c.r.lg.Errorw("Fail to create file", err)
-				return err
-			}
-			defer dstFile.Close()
-
-			_, err = io.Copy(dstFile, srcFile)
-			if err != nil {
-				c.r.lg.Errorw("Fail to copy data", err)
-				return err
-			}
-		}
-
-		return nil
+	reader, err := zip.NewReader(archiveFile, archiveInfo.Size())
+	if err != nil {
+		return dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: err.Error()}
 	}
 
 	filter := func(p string) bool {
@@ -103,12 +78,37 @@ func (c *Zip) Extract(archive io.Reader, dstDirPath string) error {
 		skipDirPrefix += "/"
 	}
 
+	// validate all entries before extraction
+	// (actual sizes are checked against declared ones by zip-reader)
+
+	entries := make([]*zip.File, 0, len(reader.File))
+	dstPaths := make([]string, 0, len(reader.File))
+
+	var totalSize uint64
+
 	for _, f := range reader.File {
-		if filter(f.Name) {
+		if filter(f.Name) || f.FileInfo().IsDir() || !f.Mode().IsRegular() {
 			continue
 		}
 
-		err = fileHandler(f, skipDirPrefix)
+		dstPath, err := c.entryDstPath(dstDirPath, strings.TrimPrefix(f.Name, skipDirPrefix))
+		if err != nil {
+			return err
+		}
+
+		err = c.checkEntry(f, len(entries)+1, totalSize+f.UncompressedSize64)
+		if err != nil {
+			return err
+		}
+
+		totalSize += f.UncompressedSize64
+
+		entries = append(entries, f)
+		dstPaths = append(dstPaths, dstPath)
+	}
+
+	for i, f := range entries {
+		err = c.extractFile(f, dstPaths[i])
 		if err != nil {
 			return err
 		}
@@ -117,31 +117,103 @@ func (c *Zip) Extract(archive io.Reader, dstDirPath string) error {
 	return nil
 }
 
-func (c *Zip) CompressDir(dirPath string) (*bytes.Buffer, error) {
-	result := new(bytes.Buffer)
+func (c *Zip) entryDstPath(dstDirPath string, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
 
-	zipWriter := zip.NewWriter(result)
-	defer zipWriter.Close()
+	if path.IsAbs(name) {
+		return "", dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: "absolute entry path: " + name}
+	}
 
-	err := filepath.Walk(dirPath, func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for _, seg := range strings.Split(name, "/") {
+		if seg == ".." {
+			return "", dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: "entry path escapes target dir: " + name}
 		}
+	}
 
-		if info == nil {
-			return nil
+	result := path.Join(dstDirPath, name)
+
+	if !strings.HasPrefix(result, dstDirPath+"/") {
+		return "", dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: "entry path escapes target dir: " + name}
+	}
+
+	return result, nil
+}
+
+func (c *Zip) checkEntry(f *zip.File, entryCount int, totalSize uint64) error {
+	if c.limits.MaxEntries > 0 && entryCount > c.limits.MaxEntries {
+		return dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: "too many entries"}
+	}
+
+	if c.limits.MaxFileSize > 0 && f.UncompressedSize64 > uint64(c.limits.MaxFileSize) {
+		return dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: "file is too large: " + f.Name}
+	}
+
+	if c.limits.MaxSize > 0 && totalSize > uint64(c.limits.MaxSize) {
+		return dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: "archive is too large"}
+	}
+
+	if c.limits.MaxRatio > 0 && f.UncompressedSize64 > cns.ZipRatioCheckMinSize {
+		if f.CompressedSize64 == 0 || float64(f.UncompressedSize64)/float64(f.CompressedSize64) > c.limits.MaxRatio {
+			return dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: "compression ratio is too high: " + f.Name}
 		}
+	}
 
-		if p == dirPath || info.IsDir() {
-			return nil
+	return nil
+}
+
+func (c *Zip) extractFile(f *zip.File, dstPath string) error {
+	srcFile, err := f.Open()
+	if err != nil {
+		return dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: err.Error()}
+	}
+	defer srcFile.Close()
+
+	err = c.r.storage.Put(dstPath, srcFile)
+	if err != nil {
+		if errors.Is(err, zip.ErrFormat) || errors.Is(err, zip.ErrChecksum) {
+			return dopErrs.ErrWithDesc{Err: errs.BadArchive, Desc: err.Error()}
 		}
+		c.r.lg.Errorw("Fail to put file", err, "path", dstPath)
+		return err
+	}
+
+	return nil
+}
+
+// spool copies archive to a temp file, since zip-reader requires random access
+func (c *Zip) spool(archive io.Reader) (*os.File, error) {
+	f, err := os.CreateTemp("", "fs-zip-*")
+	if err != nil {
+		c.r.lg.Errorw("Fail to create temp-file", err)
+		return nil, err
+	}
+
+	_, err = io.Copy(f, archive)
+	if err != nil {
+		c.r.lg.Errorw("Fail to copy archive to temp-file", err)
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
 
-		relPath, err := filepath.Rel(dirPath, p)
+	return f, nil
+}
+
+func (c *Zip) CompressDir(dirPath string, w io.Writer) error {
+	zipWriter := zip.NewWriter(w)
+
+	err := c.r.storage.Walk(dirPath, func(p string, info *storage.FileInfoSt, err error) error {
 		if err != nil {
 			return err
 		}
 
-		srcF, err := os.Open(p)
+		if info == nil || info.IsDir {
+			return nil
+		}
+
+		relPath := strings.TrimPrefix(p, dirPath+"/")
+
+		srcF, err := c.r.storage.Get(p)
 		if err != nil {
 			c.r.lg.Errorw("Fail to open file", err)
 			return err
@@ -164,8 +236,14 @@ func (c *Zip) CompressDir(dirPath string) (*bytes.Buffer, error) {
 	})
 	if err != nil {
 		c.r.lg.Errorw("Fail to walk dir", err, "dir_path", dirPath)
-		return nil, err
+		return err
 	}
 
-	return result, nil
+	err = zipWriter.Close()
+	if err != nil {
+		c.r.lg.Errorw("Fail to close zip-writer", err)
+		return err
+	}
+
+	return nil
 }
@@ -8,4 +8,26 @@ const (
 	BadFormData = dopErrs.Err("bad_form_data")
 	BadFile     = dopErrs.Err("bad_file")
 	BadDirName  = dopErrs.Err("bad_dir_name")
+	BadArchive  = dopErrs.Err("bad_archive")
+	BadListSort = dopErrs.Err("bad_list_sort")
+
+	BadImageFormat      = dopErrs.Err("bad_image_format")
+	BadImageQuality     = dopErrs.Err("bad_image_quality")
+	BadImageGravity     = dopErrs.Err("bad_image_gravity")
+	BadImageCrop        = dopErrs.Err("bad_image_crop")
+	BadImageBgColor     = dopErrs.Err("bad_image_bg_color")
+	BadImageRotate      = dopErrs.Err("bad_image_rotate")
+	BadImageFlip        = dopErrs.Err("bad_image_flip")
+	BadImageSize        = dopErrs.Err("bad_image_size")
+	ImageSizeNotAllowed = dopErrs.Err("image_size_not_allowed")
+	ImageBlurNotAllowed = dopErrs.Err("image_blur_not_allowed")
+	ImageSourceTooLarge = dopErrs.Err("image_source_too_large")
+	ImageQueueTimeout   = dopErrs.Err("image_queue_timeout")
+	BadImagePreset      = dopErrs.Err("bad_image_preset")
+	ImagePresetRequired = dopErrs.Err("image_preset_required")
+	BadImageAdjustment  = dopErrs.Err("bad_image_adjustment")
+
+	BadSignature      = dopErrs.Err("bad_signature")
+	SignatureExpired  = dopErrs.Err("signature_expired")
+	SignNotConfigured = dopErrs.Err("sign_not_configured")
 )
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/rendau/fs/internal/domain/util"
+)
+
+const AuthScopeAll = "*"
+
+type AuthScopeSt struct {
+	Dirs        []string `json:"dirs"`
+	KvsPrefixes []string `json:"kvs"`
+	Admin       bool     `json:"admin"`
+
+	// Id identifies token owner: "key:<hash of api-key>" or "jwt:<subject>", empty if auth is disabled
+	Id string `json:"-"`
+}
+
+func NewFullAuthScope() *AuthScopeSt {
+	return &AuthScopeSt{
+		Dirs:        []string{AuthScopeAll},
+		KvsPrefixes: []string{AuthScopeAll},
+		Admin:       true,
+	}
+}
+
+// HasDir checks that dir is one of scope dirs or is inside of one.
+// Dir is normalized as storage path, so the checked path is the one that is accessed.
+func (o *AuthScopeSt) HasDir(dir string) bool {
+	dir = util.ToStoragePath(dir)
+
+	for _, d := range o.Dirs {
+		if d == AuthScopeAll {
+			return true
+		}
+
+		d = util.ToStoragePath(d)
+
+		if dir == d || strings.HasPrefix(dir, d+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasKvsKey checks that key starts with one of scope kvs-prefixes.
+// Key is normalized as storage path, so the checked key is the one that is accessed.
+func (o *AuthScopeSt) HasKvsKey(key string) bool {
+	key = util.ToStoragePath(key)
+
+	for _, p := range o.KvsPrefixes {
+		if p == AuthScopeAll || strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+
+	return false
+}
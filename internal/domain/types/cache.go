@@ -0,0 +1,11 @@
+package types
+
+type CacheStatsSt struct {
+	Count     int   `json:"count"`
+	Size      int64 `json:"size"`
+	MaxCount  int   `json:"max_count"` // 0 - no limit
+	MaxSize   int64 `json:"max_size"`  // 0 - no limit
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"` // removed by limits
+}
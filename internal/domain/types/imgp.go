@@ -4,28 +4,99 @@ import (
 	"fmt"
 )
 
+type ImgSizeSt struct {
+	Width  int
+	Height int
+}
+
+// ImgLimitsSt - limits for image params from requests, zero values mean no limit
+type ImgLimitsSt struct {
+	MaxWidth        int
+	MaxHeight       int
+	MaxBlur         float64     // sigma of blur and sharpen
+	Sizes           []ImgSizeSt // allowlist of w/h pairs
+	MaxSourcePixels int64       // width*height of source image, checked before decoding
+	MaxUploadPixels int64       // same for downscaling of uploads, larger images are stored as is
+}
+
+type ImgQueueStatsSt struct {
+	Concurrency int   // max count of parallel transformations, 0 - no limit
+	Running     int64 // transformations in progress
+	Waiting     int64 // transformations waiting for a free slot
+	Timeouts    int64 // total count of transformations rejected by queue timeout
+}
+
+// ImgCropSt is a region (in source image pixels) to crop before other transformations
+type ImgCropSt struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+func (o ImgCropSt) IsEmpty() bool {
+	return o.Width == 0 && o.Height == 0
+}
+
 type ImgParsSt struct {
-	WMark     bool
-	Method    string
-	Width     int
-	Height    int
-	Blur      float64
-	Grayscale bool
+	WMark      bool
+	Method     string
+	Gravity    string
+	Width      int
+	Height     int
+	Crop       ImgCropSt
+	BgColor    string
+	Rotate     int    // clockwise: 90, 180, 270
+	Flip       string // "h", "v", "hv"
+	Blur       float64
+	Sharpen    float64
+	Grayscale  bool
+	Brightness float64 // -100..100
+	Contrast   float64 // -100..100
+	Gamma      float64 // > 0, 1 - no changes
+	Saturation float64 // -100..500
+	Format     string
+	Quality    int
 }
 
 func (o *ImgParsSt) Reset() {
 	o.Method = ""
+	o.Gravity = ""
 	o.Width = 0
 	o.Height = 0
+	o.Crop = ImgCropSt{}
+	o.BgColor = ""
+	o.Rotate = 0
+	o.Flip = ""
 	o.Blur = 0
+	o.Sharpen = 0
 	o.Grayscale = false
+	o.Brightness = 0
+	o.Contrast = 0
+	o.Gamma = 0
+	o.Saturation = 0
 	o.WMark = false
+	o.Format = ""
+	o.Quality = 0
 }
 
 func (o *ImgParsSt) IsEmpty() bool {
-	return o.Width == 0 && o.Height == 0 && o.Blur == 0 && !o.Grayscale && !o.WMark
+	return o.Width == 0 && o.Height == 0 &&
+		o.Crop.IsEmpty() &&
+		o.Rotate == 0 && o.Flip == "" &&
+		o.Blur == 0 && o.Sharpen == 0 && !o.Grayscale &&
+		o.Brightness == 0 && o.Contrast == 0 && o.Gamma == 0 && o.Saturation == 0 &&
+		!o.WMark &&
+		o.Format == "" && o.Quality == 0
 }
 
 func (o *ImgParsSt) String() string {
-	return fmt.Sprintf("m=%s&w=%d&h=%d&blur=%fgrayscale=%vwm=%v", o.Method, o.Width, o.Height, o.Blur, o.Grayscale, o.WMark)
+	return fmt.Sprintf(
+		"m=%s&g=%s&w=%d&h=%d&bg=%s&crop=%d,%d,%d,%d&rotate=%d&flip=%s&blur=%fsharpen=%fgrayscale=%v"+
+			"&brightness=%f&contrast=%f&gamma=%f&saturation=%fwm=%v&fmt=%s&q=%d",
+		o.Method, o.Gravity, o.Width, o.Height, o.BgColor,
+		o.Crop.X, o.Crop.Y, o.Crop.Width, o.Crop.Height,
+		o.Rotate, o.Flip, o.Blur, o.Sharpen, o.Grayscale,
+		o.Brightness, o.Contrast, o.Gamma, o.Saturation, o.WMark, o.Format, o.Quality,
+	)
 }
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"io"
+	"time"
+)
+
+type StaticFileSt struct {
+	Name         string
+	OriginalName string // name of uploaded file, if it was uploaded with meta
+	ModTime      time.Time
+	Content      io.ReadSeekCloser
+
+	// WriteTo is set instead of Content for content generated on the fly (not seekable)
+	WriteTo func(w io.Writer) error
+}
+
+func (o *StaticFileSt) Close() error {
+	if o.Content != nil {
+		return o.Content.Close()
+	}
+
+	return nil
+}
+
+type StaticListParsSt struct {
+	Page     int64
+	PageSize int64
+	SortName string // name, size, mtime
+	SortDesc bool
+}
+
+type StaticListItemSt struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"` // zip-dir path ends with "/"
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	IsDir    bool      `json:"is_dir"`
+	IsZipDir bool      `json:"is_zip_dir"`
+}
+
+type StaticMetaSt struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ModTime     time.Time `json:"mtime"`
+	Sha256      string    `json:"sha256"` // hex
+
+	// only for images
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Orientation string `json:"orientation,omitempty" enums:"landscape,portrait,square"`
+
+	// name of uploaded file, empty if unknown
+	OriginalName string `json:"original_name,omitempty"`
+}
+
+// StaticUploadMetaSt is stored alongside of uploaded file
+type StaticUploadMetaSt struct {
+	OriginalName string            `json:"original_name"`
+	Uploader     string            `json:"uploader,omitempty"` // id of auth token
+	ContentType  string            `json:"content_type"`
+	Size         int64             `json:"size"`
+	Sha256       string            `json:"sha256"` // hex
+	Tags         map[string]string `json:"tags,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
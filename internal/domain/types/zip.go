@@ -0,0 +1,9 @@
+package types
+
+// ZipLimitsSt - limits for extracted archives, zero values mean no limit
+type ZipLimitsSt struct {
+	MaxSize     int64   // total uncompressed size in bytes
+	MaxFileSize int64   // uncompressed size of single file in bytes
+	MaxEntries  int     // count of entries in archive
+	MaxRatio    float64 // uncompressed/compressed size ratio of single file
+}
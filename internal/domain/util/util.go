@@ -16,6 +16,10 @@ func ToFsPath(v string) string {
 	return filepath.Join(strings.Split(v, "/")...)
 }
 
+func ToStoragePath(v string) string {
+	return filepath.ToSlash(ToFsPath(v))
+}
+
 func ToUrlPath(v string) string {
 	return path.Join(strings.Split(strings.TrimPrefix(strings.TrimSuffix(v, "/"), "/"), "/")...)
 }
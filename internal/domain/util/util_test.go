@@ -132,3 +132,42 @@ func Test_ToUrlPath(t *testing.T) {
 		})
 	}
 }
+
+func Test_ToStoragePath(t *testing.T) {
+	type args struct {
+		v string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "Slash",
+			args: args{v: "asd/dsa/qwe"},
+			want: "asd/dsa/qwe",
+		},
+		{
+			name: "Empty string",
+			args: args{v: ""},
+			want: "",
+		},
+		{
+			name: "Slash prefix and suffix",
+			args: args{v: "/asd/dsa/qwe/"},
+			want: "asd/dsa/qwe",
+		},
+		{
+			name: "Parent dir",
+			args: args{v: "dsa/qwe/../../../../asd"},
+			want: "dsa/qwe/asd",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToStoragePath(tt.args.v); got != tt.want {
+				t.Errorf("ToStoragePath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
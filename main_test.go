@@ -3,19 +3,40 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
 	"image/color"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/disintegration/imaging"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rendau/dop/dopErrs"
 	cleanerMock "github.com/rendau/fs/internal/adapters/cleaner/mock"
 	"github.com/rendau/fs/internal/adapters/logger/zap"
+	"github.com/rendau/fs/internal/adapters/server/rest"
+	"github.com/rendau/fs/internal/adapters/storage"
+	storageLocal "github.com/rendau/fs/internal/adapters/storage/local"
+	storageMem "github.com/rendau/fs/internal/adapters/storage/mem"
 	"github.com/rendau/fs/internal/cns"
 	"github.com/rendau/fs/internal/domain/core"
 	"github.com/rendau/fs/internal/domain/errs"
@@ -29,6 +50,10 @@ const confPath = "test_conf.yml"
 const testDirPath = "test_dir"
 const imgMaxWidth = 1000
 const imgMaxHeight = 1000
+const zipMaxSize = 10 * 1024 * 1024
+const zipMaxFileSize = 5 * 1024 * 1024
+const zipMaxEntries = 20
+const zipMaxRatio = 50
 
 type fsItemSt struct {
 	p  string
@@ -100,14 +125,19 @@ func TestMain(m *testing.M) {
 	app.core = core.New(
 		app.lg,
 		app.cleaner,
-		testDirPath,
-		imgMaxWidth,
-		imgMaxHeight,
-		"",
-		0,
-		[]string{},
-		0,
-		time.Minute,
+		storageLocal.New(testDirPath),
+		nil,
+		core.ConfSt{
+			ImgMaxWidth:  imgMaxWidth,
+			ImgMaxHeight: imgMaxHeight,
+			ZipLimits: types.ZipLimitsSt{
+				MaxSize:     zipMaxSize,
+				MaxFileSize: zipMaxFileSize,
+				MaxEntries:  zipMaxEntries,
+				MaxRatio:    zipMaxRatio,
+			},
+			CacheTtl: time.Minute,
+		},
 		true,
 	)
 
@@ -122,15 +152,15 @@ func TestMain(m *testing.M) {
 func TestCreate(t *testing.T) {
 	cleanTestDir()
 
-	_, err := app.core.Static.Create("asd/"+cns.ZipDirNamePrefix+"_asd", "a.txt", bytes.NewBuffer([]byte("test_data")), false, false)
+	_, err := app.core.Static.Create("asd/"+cns.ZipDirNamePrefix+"_asd", "a.txt", bytes.NewBuffer([]byte("test_data")), false, false, nil)
 	require.NotNil(t, err)
 	require.Equal(t, errs.BadDirName, err)
 
-	_, err = app.core.Static.Create(cns.ZipDirNamePrefix+"_asd/asd", "a.txt", bytes.NewBuffer([]byte("test_data")), false, false)
+	_, err = app.core.Static.Create(cns.ZipDirNamePrefix+"_asd/asd", "a.txt", bytes.NewBuffer([]byte("test_data")), false, false, nil)
 	require.NotNil(t, err)
 	require.Equal(t, errs.BadDirName, err)
 
-	fPath, err := app.core.Static.Create("photos", "data.txt", bytes.NewBuffer([]byte("test_data")), false, false)
+	fPath, err := app.core.Static.Create("photos", "data.txt", bytes.NewBuffer([]byte("test_data")), false, false, nil)
 	require.Nil(t, err)
 
 	fPathPrefix := "photos/" + time.Now().Format("2006/01/02") + "/"
@@ -138,12 +168,21 @@ func TestCreate(t *testing.T) {
 	require.True(t, strings.HasPrefix(fPath, fPathPrefix))
 	require.False(t, strings.Contains(strings.TrimPrefix(fPath, fPathPrefix), "/"))
 
-	fName, _, fContent, err := app.core.Static.Get(fPath, &types.ImgParsSt{}, false)
+	fName, _, fContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{}, false)
 	require.Nil(t, err)
 	require.NotNil(t, fContent)
 	require.Equal(t, "test_data", string(fContent))
 	require.NotEmpty(t, fName)
 
+	file, err := app.core.Static.Get(fPath, &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	_, err = file.Content.Seek(5, io.SeekStart)
+	require.Nil(t, err)
+	fContent, err = io.ReadAll(file.Content)
+	require.Nil(t, err)
+	require.Equal(t, "data", string(fContent))
+	require.Nil(t, file.Close())
+
 	largeImg := imaging.New(imgMaxWidth+10, imgMaxHeight+10, color.RGBA{R: 0xaa, G: 0x00, B: 0x00, A: 0xff})
 	require.NotNil(t, largeImg)
 
@@ -152,170 +191,2016 @@ func TestCreate(t *testing.T) {
 	err = imaging.Encode(largeImgBuffer, largeImg, imaging.JPEG)
 	require.Nil(t, err)
 
-	fPath, err = app.core.Static.Create("photos", "a.jpg", largeImgBuffer, true, false)
+	fPath, err = app.core.Static.Create("photos", "a.jpg", largeImgBuffer, true, false, nil)
+	require.Nil(t, err)
+
+	_, _, fContent, err = getStatic(t, app.core, fPath, &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	require.NotNil(t, fContent)
+
+	img, err := imaging.Decode(bytes.NewBuffer(fContent))
+	require.Nil(t, err)
+
+	imgBounds := img.Bounds().Max
+	require.Equal(t, imgMaxWidth+10, imgBounds.X)
+	require.Equal(t, imgMaxHeight+10, imgBounds.X)
+
+	largeImg = imaging.New(imgMaxWidth+10, imgMaxHeight+10, color.RGBA{R: 0xaa, G: 0x00, B: 0x00, A: 0xff})
+	require.NotNil(t, largeImg)
+
+	largeImgBuffer = new(bytes.Buffer)
+
+	err = imaging.Encode(largeImgBuffer, largeImg, imaging.JPEG)
+	require.Nil(t, err)
+
+	fPath, err = app.core.Static.Create("photos", "a.jpg", largeImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	_, _, fContent, err = getStatic(t, app.core, fPath, &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	require.NotNil(t, fContent)
+
+	img, err = imaging.Decode(bytes.NewBuffer(fContent))
+	require.Nil(t, err)
+
+	imgBounds = img.Bounds().Max
+	require.Equal(t, imgMaxWidth, imgBounds.X)
+	require.Equal(t, imgMaxHeight, imgBounds.X)
+
+	_, _, fContent, err = getStatic(t, app.core, fPath, &types.ImgParsSt{Method: "fit", Width: imgMaxWidth - 10, Height: imgMaxHeight - 10}, false)
+	require.Nil(t, err)
+	require.NotNil(t, fContent)
+
+	img, err = imaging.Decode(bytes.NewBuffer(fContent))
+	require.Nil(t, err)
+
+	imgBounds = img.Bounds().Max
+	require.Equal(t, imgMaxWidth-10, imgBounds.X)
+	require.Equal(t, imgMaxHeight-10, imgBounds.X)
+
+	_, _, fContent, err = getStatic(t, app.core, fPath, &types.ImgParsSt{Method: "fit", Width: imgMaxWidth + 10, Height: imgMaxHeight + 10}, false)
+	require.Nil(t, err)
+	require.NotNil(t, fContent)
+
+	img, err = imaging.Decode(bytes.NewBuffer(fContent))
+	require.Nil(t, err)
+
+	imgBounds = img.Bounds().Max
+	require.Equal(t, imgMaxWidth, imgBounds.X)
+	require.Equal(t, imgMaxHeight, imgBounds.X)
+}
+
+func TestImgFormat(t *testing.T) {
+	cleanTestDir()
+
+	srcImg := imaging.New(200, 100, color.RGBA{R: 0x00, G: 0xaa, B: 0x00, A: 0xff})
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, srcImg, imaging.JPEG)
+	require.Nil(t, err)
+
+	fPath, err := app.core.Static.Create("photos", "a.jpg", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	_, err = app.core.Static.Get(fPath, &types.ImgParsSt{Format: "gif"}, false)
+	require.Equal(t, errs.BadImageFormat, err)
+
+	for _, c := range []struct {
+		format string
+		ext    string
+	}{
+		{"png", ".png"},
+		{"webp", ".webp"},
+		{"jpeg", ".jpg"},
+	} {
+		fName, _, fContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{Width: 100, Format: c.format}, false)
+		require.Nil(t, err)
+		require.Equal(t, c.ext, path.Ext(fName))
+
+		img, imgFormat, err := image.Decode(bytes.NewBuffer(fContent))
+		require.Nil(t, err)
+		require.Equal(t, c.format, imgFormat)
+		require.Equal(t, 100, img.Bounds().Dx())
+		require.Equal(t, 50, img.Bounds().Dy())
+	}
+
+	// conversion without other changes
+	fName, _, fContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{Format: "webp"}, false)
+	require.Nil(t, err)
+	require.Equal(t, ".webp", path.Ext(fName))
+
+	img, imgFormat, err := image.Decode(bytes.NewBuffer(fContent))
+	require.Nil(t, err)
+	require.Equal(t, "webp", imgFormat)
+	require.Equal(t, 200, img.Bounds().Dx())
+
+	// webp source
+	fPath, err = app.core.Static.Create("photos", "b.webp", bytes.NewBuffer(fContent), false, false, nil)
+	require.Nil(t, err)
+
+	fName, _, fContent, err = getStatic(t, app.core, fPath, &types.ImgParsSt{Width: 50}, false)
+	require.Nil(t, err)
+	require.Equal(t, ".webp", path.Ext(fName))
+
+	img, imgFormat, err = image.Decode(bytes.NewBuffer(fContent))
+	require.Nil(t, err)
+	require.Equal(t, "webp", imgFormat)
+	require.Equal(t, 50, img.Bounds().Dx())
+
+	format, vary := app.core.Img.NegotiateFormat("a.png", "image/webp,*/*")
+	require.Equal(t, "", format)
+	require.False(t, vary)
+
+	autoCore := newTestCore(storageMem.New(), nil, func(conf *core.ConfSt) {
+		conf.ImgAutoFormat = true
+	})
+
+	for _, c := range []struct {
+		fPath  string
+		accept string
+		format string
+		vary   bool
+	}{
+		{"photos/a.png", "image/avif,image/webp,*/*", "webp", true},
+		{"photos/a.PNG", "image/webp;q=0.8", "webp", true},
+		{"photos/a.png", "image/webp;q=0,*/*", "", true},
+		{"photos/a.png", "*/*", "", true},
+		{"photos/a.jpg", "image/webp", "webp", true},
+		{"photos/a.JPEG", "*/*", "", true},
+		{"photos/a.webp", "image/webp", "", false},
+		{"docs/a.pdf", "image/webp", "", false},
+	} {
+		format, vary = autoCore.Img.NegotiateFormat(c.fPath, c.accept)
+		require.Equal(t, c.format, format, c.fPath+" "+c.accept)
+		require.Equal(t, c.vary, vary, c.fPath+" "+c.accept)
+	}
+
+	// http level
+	srcImgBuffer.Reset()
+
+	err = imaging.Encode(srcImgBuffer, srcImg, imaging.PNG)
+	require.Nil(t, err)
+
+	pngPath, err := autoCore.Static.Create("photos", "c.png", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	srcImgBuffer.Reset()
+
+	err = imaging.Encode(srcImgBuffer, srcImg, imaging.JPEG)
+	require.Nil(t, err)
+
+	jpgPath, err := autoCore.Static.Create("photos", "c.jpg", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	handler := rest.GetHandler(app.lg, autoCore, false, nil, false)
+
+	for _, c := range []struct {
+		uri         string
+		accept      string
+		contentType string
+		vary        string
+	}{
+		{"/static/" + pngPath, "image/webp,*/*", "image/webp", "Accept"},
+		{"/static/" + pngPath, "*/*", "image/png", "Accept"},
+		{"/static/" + pngPath + "?fmt=png", "image/webp,*/*", "image/png", ""},
+		{"/static/" + jpgPath, "image/webp,*/*", "image/webp", "Accept"},
+		{"/static/" + jpgPath, "image/jpeg,*/*", "image/jpeg", "Accept"},
+		{"/static/" + jpgPath + "?fmt=jpeg", "image/webp,*/*", "image/jpeg", ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.uri, nil)
+		req.Header.Set("Accept", c.accept)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, c.uri+" "+c.accept)
+		require.Equal(t, c.vary, rec.Header().Get("Vary"), c.uri+" "+c.accept)
+
+		_, imgFormat, err := image.Decode(rec.Body)
+		require.Nil(t, err, c.uri+" "+c.accept)
+		require.Equal(t, c.contentType, "image/"+imgFormat, c.uri+" "+c.accept)
+	}
+}
+
+func TestImgCrop(t *testing.T) {
+	cleanTestDir()
+
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+
+	srcImg := imaging.New(200, 100, red)
+	srcImg = imaging.Paste(srcImg, imaging.New(100, 100, blue), image.Pt(100, 0))
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, srcImg, imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := app.core.Static.Create("photos", "a.png", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	getImg := func(pars *types.ImgParsSt) image.Image {
+		_, _, fContent, err := getStatic(t, app.core, fPath, pars, false)
+		require.Nil(t, err)
+
+		img, err := imaging.Decode(bytes.NewBuffer(fContent))
+		require.Nil(t, err)
+
+		return img
+	}
+
+	img := getImg(&types.ImgParsSt{Width: 50, Height: 50, Gravity: "west"})
+	require.Equal(t, image.Pt(50, 50), img.Bounds().Size())
+	require.Equal(t, red, imaging.Clone(img).NRGBAAt(25, 25))
+
+	img = getImg(&types.ImgParsSt{Width: 50, Height: 50, Gravity: "south-east"})
+	require.Equal(t, blue, imaging.Clone(img).NRGBAAt(25, 25))
+
+	img = getImg(&types.ImgParsSt{Crop: types.ImgCropSt{X: 150, Y: 10, Width: 100, Height: 50}})
+	require.Equal(t, image.Pt(50, 50), img.Bounds().Size())
+	require.Equal(t, blue, imaging.Clone(img).NRGBAAt(0, 0))
+
+	img = getImg(&types.ImgParsSt{Crop: types.ImgCropSt{X: 0, Y: 0, Width: 100, Height: 100}, Width: 10})
+	require.Equal(t, image.Pt(10, 10), img.Bounds().Size())
+	require.Equal(t, red, imaging.Clone(img).NRGBAAt(9, 9))
+
+	_, err = app.core.Static.Get(fPath, &types.ImgParsSt{Width: 50, Gravity: "up"}, false)
+	require.Equal(t, errs.BadImageGravity, err)
+
+	_, err = app.core.Static.Get(fPath, &types.ImgParsSt{Crop: types.ImgCropSt{X: -1, Width: 10, Height: 10}}, false)
+	require.Equal(t, errs.BadImageCrop, err)
+
+	_, err = app.core.Static.Get(fPath, &types.ImgParsSt{Crop: types.ImgCropSt{X: 300, Width: 10, Height: 10}}, false)
+	require.Equal(t, errs.BadImageCrop, err)
+}
+
+func TestImgPad(t *testing.T) {
+	cleanTestDir()
+
+	red := color.NRGBA{R: 0xff, A: 0xff}
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(200, 100, red), imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := app.core.Static.Create("photos", "a.png", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	getImg := func(pars *types.ImgParsSt) *image.NRGBA {
+		_, _, fContent, err := getStatic(t, app.core, fPath, pars, false)
+		require.Nil(t, err)
+
+		img, err := imaging.Decode(bytes.NewBuffer(fContent))
+		require.Nil(t, err)
+
+		return imaging.Clone(img)
+	}
+
+	img := getImg(&types.ImgParsSt{Method: "pad", Width: 50, Height: 50})
+	require.Equal(t, image.Pt(50, 50), img.Bounds().Size())
+	require.Equal(t, uint8(0), img.NRGBAAt(25, 2).A)
+	require.Equal(t, red, img.NRGBAAt(25, 25))
+
+	img = getImg(&types.ImgParsSt{Method: "pad", Width: 50, Height: 50, BgColor: "#00f"})
+	require.Equal(t, color.NRGBA{B: 0xff, A: 0xff}, img.NRGBAAt(25, 2))
+
+	// smaller image is not enlarged
+	img = getImg(&types.ImgParsSt{Method: "pad", Width: 400, Height: 400, BgColor: "00ff00"})
+	require.Equal(t, image.Pt(400, 400), img.Bounds().Size())
+	require.Equal(t, color.NRGBA{G: 0xff, A: 0xff}, img.NRGBAAt(200, 100))
+	require.Equal(t, red, img.NRGBAAt(200, 200))
+
+	img = getImg(&types.ImgParsSt{Method: "pad", Width: 50, Height: 50, Format: "jpeg"})
+	require.Greater(t, img.NRGBAAt(25, 2).G, uint8(0xf0))
+
+	_, err = app.core.Static.Get(fPath, &types.ImgParsSt{Method: "pad", Width: 50, BgColor: "xyz"}, false)
+	require.Equal(t, errs.BadImageBgColor, err)
+}
+
+func TestImgAdjust(t *testing.T) {
+	cleanTestDir()
+
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+
+	// red left half, blue right half
+	srcImg := imaging.New(200, 100, red)
+	srcImg = imaging.Paste(srcImg, imaging.New(100, 100, blue), image.Pt(100, 0))
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, srcImg, imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := app.core.Static.Create("photos", "a.png", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	getImg := func(pars *types.ImgParsSt) *image.NRGBA {
+		_, _, fContent, err := getStatic(t, app.core, fPath, pars, false)
+		require.Nil(t, err)
+
+		img, err := imaging.Decode(bytes.NewBuffer(fContent))
+		require.Nil(t, err)
+
+		return imaging.Clone(img)
+	}
+
+	img := getImg(&types.ImgParsSt{Rotate: 90})
+	require.Equal(t, image.Pt(100, 200), img.Bounds().Size())
+	require.Equal(t, red, img.NRGBAAt(50, 10))
+	require.Equal(t, blue, img.NRGBAAt(50, 190))
+
+	img = getImg(&types.ImgParsSt{Rotate: 270})
+	require.Equal(t, blue, img.NRGBAAt(50, 10))
+
+	img = getImg(&types.ImgParsSt{Flip: "h"})
+	require.Equal(t, blue, img.NRGBAAt(10, 50))
+
+	img = getImg(&types.ImgParsSt{Flip: "hv", Rotate: 180})
+	require.Equal(t, red, img.NRGBAAt(10, 50))
+
+	img = getImg(&types.ImgParsSt{Grayscale: true})
+	c := img.NRGBAAt(10, 50)
+	require.Equal(t, c.R, c.G)
+	require.Equal(t, c.G, c.B)
+
+	img = getImg(&types.ImgParsSt{Brightness: 50})
+	require.Greater(t, img.NRGBAAt(10, 50).G, uint8(0))
+
+	img = getImg(&types.ImgParsSt{Saturation: -100})
+	c = img.NRGBAAt(10, 50)
+	require.Equal(t, c.R, c.G)
+
+	// mid-tone pattern for adjustments
+	srcImg = imaging.New(100, 100, color.White)
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			srcImg.Set(x, y, color.RGBA{R: uint8(64 + x), G: uint8(64 + y), B: uint8(64 + (x^y)%64), A: 0xff})
+		}
+	}
+
+	srcImgBuffer.Reset()
+
+	err = imaging.Encode(srcImgBuffer, srcImg, imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err = app.core.Static.Create("photos", "b.png", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	_, _, srcContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+
+	for _, pars := range []*types.ImgParsSt{
+		{Contrast: 20},
+		{Gamma: 0.5},
+		{Sharpen: 1},
+		{Blur: 1},
+	} {
+		_, _, fContent, err := getStatic(t, app.core, fPath, pars, false)
+		require.Nil(t, err)
+		require.NotEqual(t, srcContent, fContent, pars.String())
+	}
+
+	for _, c := range []struct {
+		pars *types.ImgParsSt
+		err  error
+	}{
+		{&types.ImgParsSt{Rotate: 45}, errs.BadImageRotate},
+		{&types.ImgParsSt{Flip: "x"}, errs.BadImageFlip},
+		{&types.ImgParsSt{Brightness: 101}, errs.BadImageAdjustment},
+		{&types.ImgParsSt{Contrast: -101}, errs.BadImageAdjustment},
+		{&types.ImgParsSt{Saturation: 501}, errs.BadImageAdjustment},
+		{&types.ImgParsSt{Gamma: -1}, errs.BadImageAdjustment},
+	} {
+		_, err = app.core.Static.Get(fPath, c.pars, false)
+		require.Equal(t, c.err, err, c.pars.String())
+	}
+}
+
+func TestImgPresets(t *testing.T) {
+	cleanTestDir()
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(200, 100, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := app.core.Static.Create("photos", "a.png", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	presets := map[string]string{
+		"thumb": "w=50&h=50&m=fit",
+		"bad":   "w=abc",
+	}
+
+	request := func(handler http.Handler, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/"+fPath+"?"+query, nil))
+		return rec
+	}
+
+	imgSize := func(rec *httptest.ResponseRecorder) image.Point {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		img, err := imaging.Decode(rec.Body)
+		require.Nil(t, err)
+
+		return img.Bounds().Size()
+	}
+
+	handler := rest.GetHandler(app.lg, app.core, false, presets, false)
+
+	require.Equal(t, image.Pt(50, 25), imgSize(request(handler, "preset=thumb")))
+	require.Equal(t, image.Pt(20, 10), imgSize(request(handler, "preset=thumb&w=20&h=20")))
+	require.Equal(t, image.Pt(30, 30), imgSize(request(handler, "w=30&h=30")))
+
+	rec := request(handler, "preset=bad")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), errs.BadImagePreset.Error())
+
+	handler = rest.GetHandler(app.lg, app.core, false, presets, true)
+
+	require.Equal(t, image.Pt(50, 25), imgSize(request(handler, "preset=thumb&fmt=png")))
+	require.Equal(t, image.Pt(200, 100), imgSize(request(handler, "")))
+
+	for _, query := range []string{"w=30&h=30", "preset=thumb&w=20", "blur=2"} {
+		rec = request(handler, query)
+		require.Equal(t, http.StatusBadRequest, rec.Code, query)
+		require.Contains(t, rec.Body.String(), errs.ImagePresetRequired.Error(), query)
+	}
+}
+
+func TestImgLimits(t *testing.T) {
+	memStorage := storageMem.New()
+
+	limitedCore := newTestCore(memStorage, nil, func(conf *core.ConfSt) {
+		conf.ImgLimits = types.ImgLimitsSt{
+			MaxWidth:        500,
+			MaxHeight:       500,
+			MaxBlur:         5,
+			Sizes:           []types.ImgSizeSt{{Width: 100, Height: 100}, {Width: 50, Height: 0}},
+			MaxSourcePixels: 300 * 300,
+		}
+	})
+
+	createImg := func(w, h int, noCut bool) (string, error) {
+		buffer := new(bytes.Buffer)
+
+		err := imaging.Encode(buffer, imaging.New(w, h, color.White), imaging.PNG)
+		require.Nil(t, err)
+
+		return limitedCore.Static.Create("photos", "a.png", buffer, noCut, false, nil)
+	}
+
+	fPath, err := createImg(200, 200, false)
+	require.Nil(t, err)
+
+	for _, c := range []struct {
+		pars *types.ImgParsSt
+		err  error
+	}{
+		{&types.ImgParsSt{Width: 100, Height: 100}, nil},
+		{&types.ImgParsSt{Width: 50}, nil},
+		{&types.ImgParsSt{Blur: 5}, nil},
+		{&types.ImgParsSt{Width: 100}, errs.ImageSizeNotAllowed},
+		{&types.ImgParsSt{Width: 600, Height: 100}, errs.ImageSizeNotAllowed},
+		{&types.ImgParsSt{Width: -1}, errs.BadImageSize},
+		{&types.ImgParsSt{Blur: 6}, errs.ImageBlurNotAllowed},
+		{&types.ImgParsSt{Sharpen: 6}, errs.ImageBlurNotAllowed},
+	} {
+		_, _, _, err = getStatic(t, limitedCore, fPath, c.pars, false)
+		require.Equal(t, c.err, err, c.pars.String())
+	}
+
+	// pad canvas with derived height
+	fPath, err = createImg(1, 1000, true)
+	require.Nil(t, err)
+
+	_, _, _, err = getStatic(t, limitedCore, fPath, &types.ImgParsSt{Method: "pad", Width: 50}, false)
+	require.Equal(t, errs.ImageSizeNotAllowed, err)
+
+	_, _, _, err = getStatic(t, limitedCore, fPath, &types.ImgParsSt{Method: "fit", Width: 50}, false)
+	require.Nil(t, err)
+
+	// source pixels limit
+	fPath, err = createImg(400, 400, true)
+	require.Nil(t, err)
+
+	_, _, _, err = getStatic(t, limitedCore, fPath, &types.ImgParsSt{Width: 100, Height: 100}, false)
+	require.Equal(t, errs.ImageSourceTooLarge, err)
+
+	_, _, fContent, err := getStatic(t, limitedCore, fPath, &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	require.NotEmpty(t, fContent)
+
+	// uploads are not limited by source pixels
+	_, err = createImg(400, 400, false)
+	require.Nil(t, err)
+
+	// uploads larger than upload limit are stored as is
+	uploadCore := newTestCore(storageMem.New(), nil, func(conf *core.ConfSt) {
+		conf.ImgMaxWidth = 100
+		conf.ImgMaxHeight = 100
+		conf.ImgLimits = types.ImgLimitsSt{
+			MaxSourcePixels: 10 * 10,
+			MaxUploadPixels: 300 * 300,
+		}
+	})
+
+	for _, c := range []struct {
+		size   int
+		result int
+	}{
+		{200, 100},
+		{400, 400},
+	} {
+		buffer := new(bytes.Buffer)
+
+		err = imaging.Encode(buffer, imaging.New(c.size, c.size, color.White), imaging.PNG)
+		require.Nil(t, err)
+
+		fPath, err = uploadCore.Static.Create("photos", "a.png", buffer, false, false, nil)
+		require.Nil(t, err)
+
+		_, _, fContent, err = getStatic(t, uploadCore, fPath, &types.ImgParsSt{}, false)
+		require.Nil(t, err)
+
+		img, err := imaging.Decode(bytes.NewReader(fContent))
+		require.Nil(t, err)
+		require.Equal(t, c.result, img.Bounds().Dx())
+	}
+}
+
+func TestImgQueue(t *testing.T) {
+	blockingStorage := &blockingStorageSt{Storage: storageMem.New(), unblock: make(chan struct{})}
+
+	queueCore := newTestCore(blockingStorage, nil, func(conf *core.ConfSt) {
+		conf.ImgConcurrency = 1
+		conf.ImgQueueTimeout = 50 * time.Millisecond
+	})
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(100, 100, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := queueCore.Static.Create("photos", "a.png", srcImgBuffer, true, false, nil)
+	require.Nil(t, err)
+
+	firstErrCh := make(chan error, 1)
+
+	go func() {
+		file, err := queueCore.Static.Get(fPath, &types.ImgParsSt{Width: 10}, false)
+		if err == nil {
+			file.Close()
+		}
+		firstErrCh <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		return queueCore.Img.GetQueueStats().Running == 1
+	}, time.Second, time.Millisecond)
+
+	_, _, _, err = getStatic(t, queueCore, fPath, &types.ImgParsSt{Width: 20}, false)
+	require.Equal(t, errs.ImageQueueTimeout, err)
+
+	stats := queueCore.Img.GetQueueStats()
+	require.Equal(t, 1, stats.Concurrency)
+	require.Equal(t, int64(0), stats.Waiting)
+	require.Equal(t, int64(1), stats.Timeouts)
+
+	close(blockingStorage.unblock)
+
+	require.Nil(t, <-firstErrCh)
+	require.Equal(t, int64(0), queueCore.Img.GetQueueStats().Running)
+}
+
+func TestImgDedupe(t *testing.T) {
+	blockingStorage := &blockingStorageSt{Storage: storageMem.New(), unblock: make(chan struct{})}
+
+	dedupeCore := newTestCore(blockingStorage, nil, nil)
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(100, 100, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := dedupeCore.Static.Create("photos", "a.png", srcImgBuffer, true, false, nil)
+	require.Nil(t, err)
+
+	const reqCount = 5
+
+	wg := sync.WaitGroup{}
+	contents := make([][]byte, reqCount)
+	reqErrs := make([]error, reqCount)
+
+	for i := 0; i < reqCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			file, err := dedupeCore.Static.Get(fPath, &types.ImgParsSt{Width: 10}, false)
+			if err != nil {
+				reqErrs[i] = err
+				return
+			}
+			defer file.Close()
+
+			contents[i], reqErrs[i] = io.ReadAll(file.Content)
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(blockingStorage.unblock)
+	wg.Wait()
+
+	for i := 0; i < reqCount; i++ {
+		require.Nil(t, reqErrs[i])
+		require.NotEmpty(t, contents[i])
+		require.Equal(t, contents[0], contents[i])
+	}
+
+	require.Equal(t, int64(1), atomic.LoadInt64(&blockingStorage.getCount))
+}
+
+func TestImgQuality(t *testing.T) {
+	cleanTestDir()
+
+	srcImg := imaging.New(300, 300, color.White)
+	for x := 0; x < 300; x++ {
+		for y := 0; y < 300; y++ {
+			srcImg.Set(x, y, color.RGBA{R: uint8(x * y), G: uint8(x + y), B: uint8(x ^ y), A: 0xff})
+		}
+	}
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, srcImg, imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := app.core.Static.Create("photos", "a.png", srcImgBuffer, false, false, nil)
+	require.Nil(t, err)
+
+	_, err = app.core.Static.Get(fPath, &types.ImgParsSt{Quality: 101}, false)
+	require.Equal(t, errs.BadImageQuality, err)
+
+	_, _, lowContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{Format: "jpeg", Quality: 10}, false)
+	require.Nil(t, err)
+
+	_, _, highContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{Format: "jpeg", Quality: 95}, false)
+	require.Nil(t, err)
+	require.Less(t, len(lowContent), len(highContent))
+
+	// quality alone re-encodes
+	fName, _, fContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{Quality: 10}, false)
+	require.Nil(t, err)
+	require.Equal(t, ".png", path.Ext(fName))
+
+	_, imgFormat, err := image.Decode(bytes.NewBuffer(fContent))
+	require.Nil(t, err)
+	require.Equal(t, "png", imgFormat)
+
+	// webp
+	_, _, webpLowContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{Format: "webp", Quality: 10}, false)
+	require.Nil(t, err)
+
+	_, _, webpHighContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{Format: "webp", Quality: 95}, false)
+	require.Nil(t, err)
+	require.Less(t, len(webpLowContent), len(webpHighContent))
+
+	webpPath, err := app.core.Static.Create("photos", "a.webp", bytes.NewBuffer(webpHighContent), true, false, nil)
+	require.Nil(t, err)
+
+	fName, _, fContent, err = getStatic(t, app.core, webpPath, &types.ImgParsSt{Quality: 10}, false)
+	require.Nil(t, err)
+	require.Equal(t, ".webp", path.Ext(fName))
+	require.Less(t, len(fContent), len(webpHighContent))
+
+	autoCore := newTestCore(storageLocal.New(testDirPath), nil, func(conf *core.ConfSt) {
+		conf.ImgAutoFormat = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/static/"+fPath+"?q=10", nil)
+	req.Header.Set("Accept", "image/webp,*/*")
+
+	rec := httptest.NewRecorder()
+	rest.GetHandler(app.lg, autoCore, false, nil, false).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "Accept", rec.Header().Get("Vary"))
+	require.Equal(t, webpLowContent, rec.Body.Bytes()) // q is applied to negotiated format
+
+	limitedCore := newTestCore(storageLocal.New(testDirPath), nil, func(conf *core.ConfSt) {
+		conf.ImgQualityDefault = 10
+		conf.ImgQualityMax = 10
+	})
+
+	_, _, fContent, err = getStatic(t, limitedCore, fPath, &types.ImgParsSt{Format: "jpeg", Quality: 95}, false)
+	require.Nil(t, err)
+	require.Equal(t, lowContent, fContent)
+
+	_, _, fContent, err = getStatic(t, limitedCore, fPath, &types.ImgParsSt{Format: "jpeg"}, false)
+	require.Nil(t, err)
+	require.Equal(t, lowContent, fContent)
+}
+
+func TestCache(t *testing.T) {
+	memStorage := storageMem.New()
+
+	cacheCore := newTestCore(memStorage, nil, func(conf *core.ConfSt) {
+		conf.CacheCount = 3
+		conf.CacheSize = 100
+		conf.CacheMaxEntrySize = 50
+	})
+
+	data := func(size int) []byte {
+		return bytes.Repeat([]byte("x"), size)
+	}
+
+	mt := time.Now()
+
+	cached := func(key string) bool {
+		_, _, content := cacheCore.Cache.GetAndRefresh(key, mt)
+		return content != nil
+	}
+
+	cacheCore.Cache.Set("a", "a.jpg", mt, mt, data(40))
+	cacheCore.Cache.Set("b", "b.jpg", mt, mt, data(40))
+	require.True(t, cached("a"))
+	require.True(t, cached("b"))
+
+	// size limit, "a" is least recently used
+	cacheCore.Cache.Set("c", "c.jpg", mt, mt, data(40))
+	require.False(t, cached("a"))
+	require.True(t, cached("b"))
+	require.True(t, cached("c"))
+
+	// entry size limit
+	cacheCore.Cache.Set("d", "d.jpg", mt, mt, data(51))
+	require.False(t, cached("d"))
+
+	// replace with smaller
+	cacheCore.Cache.Set("b", "b.jpg", mt, mt, data(10))
+	cacheCore.Cache.Set("d", "d.jpg", mt, mt, data(10))
+	require.True(t, cached("b"))
+	require.True(t, cached("c"))
+	require.True(t, cached("d"))
+
+	// count limit, "b" is least recently used
+	cacheCore.Cache.Set("e", "e.jpg", mt, mt, data(10))
+	require.False(t, cached("b"))
+	require.True(t, cached("c"))
+	require.True(t, cached("d"))
+	require.True(t, cached("e"))
+
+	name, modTime, content := cacheCore.Cache.GetAndRefresh("e", mt)
+	require.Equal(t, "e.jpg", name)
+	require.Equal(t, mt, modTime)
+	require.Equal(t, data(10), content)
+
+	// source file is changed
+	_, _, content = cacheCore.Cache.GetAndRefresh("e", mt.Add(time.Second))
+	require.Nil(t, content)
+	require.False(t, cached("e"))
+
+	cacheCore.Cache.Set("photos/a.jpg?w=1", "a.jpg", mt, mt, data(1))
+	cacheCore.Cache.Set("photos/a.jpg?w=2", "a.jpg", mt, mt, data(1))
+	cacheCore.Cache.Set("photos/ab.jpg?w=1", "ab.jpg", mt, mt, data(1))
+
+	cacheCore.Cache.RemoveByPrefix("/photos/a.jpg")
+	require.False(t, cached("photos/a.jpg?w=1"))
+	require.False(t, cached("photos/a.jpg?w=2"))
+	require.True(t, cached("photos/ab.jpg?w=1"))
+
+	cacheCore.Cache.Set("photos/a.jpg?w=1", "a.jpg", mt, mt, data(1))
+
+	cacheCore.Cache.RemoveByPrefix("photos/")
+	require.False(t, cached("photos/a.jpg?w=1"))
+	require.False(t, cached("photos/ab.jpg?w=1"))
+
+	// integration with Static.Get
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(100, 100, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := cacheCore.Static.Create("photos", "a.png", srcImgBuffer, true, false, nil)
+	require.Nil(t, err)
+
+	_, _, content1, err := getStatic(t, cacheCore, fPath, &types.ImgParsSt{Width: 10}, false)
+	require.Nil(t, err)
+
+	_, _, content2, err := getStatic(t, cacheCore, fPath, &types.ImgParsSt{Width: 10}, false)
+	require.Nil(t, err)
+	require.Equal(t, content1, content2)
+
+	// replace source file
+	time.Sleep(10 * time.Millisecond)
+
+	srcImgBuffer.Reset()
+	err = imaging.Encode(srcImgBuffer, imaging.New(100, 100, color.Black), imaging.PNG)
+	require.Nil(t, err)
+	err = memStorage.Put(fPath, srcImgBuffer)
+	require.Nil(t, err)
+
+	_, _, content2, err = getStatic(t, cacheCore, fPath, &types.ImgParsSt{Width: 10}, false)
+	require.Nil(t, err)
+	require.NotEqual(t, content1, content2)
+
+	// remove source file
+	err = memStorage.Remove(fPath)
+	require.Nil(t, err)
+
+	_, err = cacheCore.Static.Get(fPath, &types.ImgParsSt{Width: 10}, false)
+	require.Equal(t, dopErrs.ObjectNotFound, err)
+}
+
+func TestDiskCache(t *testing.T) {
+	srcStorage := &blockingStorageSt{Storage: storageMem.New(), unblock: make(chan struct{})}
+	close(srcStorage.unblock)
+
+	diskCacheStorage := storageMem.New()
+
+	newCore := func(diskCacheSize int64) *core.St {
+		return newTestCore(srcStorage, diskCacheStorage, func(conf *core.ConfSt) {
+			conf.DiskCacheSize = diskCacheSize
+		})
+	}
+
+	cr := newCore(1024 * 1024)
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(100, 100, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := cr.Static.Create("photos", "a.png", srcImgBuffer, true, false, nil)
+	require.Nil(t, err)
+
+	srcGetCount := func() int64 {
+		return atomic.LoadInt64(&srcStorage.getCount)
+	}
+
+	fName, _, content1, err := getStatic(t, cr, fPath, &types.ImgParsSt{Width: 10, Format: "jpeg"}, false)
+	require.Nil(t, err)
+	require.Equal(t, ".jpg", path.Ext(fName))
+	require.Equal(t, int64(1), srcGetCount())
+
+	fName, _, content2, err := getStatic(t, cr, fPath, &types.ImgParsSt{Width: 10, Format: "jpeg"}, false)
+	require.Nil(t, err)
+	require.Equal(t, ".jpg", path.Ext(fName))
+	require.Equal(t, content1, content2)
+	require.Equal(t, int64(1), srcGetCount())
+
+	// restored after restart, files of interrupted writes are removed
+	tmpPath := fPath + "/interrupted.tmp"
+
+	err = diskCacheStorage.Put(tmpPath, bytes.NewBuffer([]byte("trunc")))
+	require.Nil(t, err)
+
+	cr = newCore(1024 * 1024)
+	cr.DiskCache.Start()
+	require.Equal(t, 1, cr.DiskCache.GetStats().Count)
+
+	_, err = diskCacheStorage.Stat(tmpPath)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, _, content2, err = getStatic(t, cr, fPath, &types.ImgParsSt{Width: 10, Format: "jpeg"}, false)
+	require.Nil(t, err)
+	require.Equal(t, content1, content2)
+	require.Equal(t, int64(1), srcGetCount())
+
+	// source is changed
+	time.Sleep(10 * time.Millisecond)
+
+	srcImgBuffer.Reset()
+	err = imaging.Encode(srcImgBuffer, imaging.New(100, 100, color.Black), imaging.PNG)
+	require.Nil(t, err)
+	err = srcStorage.Storage.Put(fPath, srcImgBuffer)
+	require.Nil(t, err)
+
+	_, _, content2, err = getStatic(t, cr, fPath, &types.ImgParsSt{Width: 10, Format: "jpeg"}, false)
+	require.Nil(t, err)
+	require.NotEqual(t, content1, content2)
+	require.Equal(t, int64(2), srcGetCount())
+
+	// size limit
+	cr = newCore(int64(len(content2)) - 1)
+
+	_, _, _, err = getStatic(t, cr, fPath, &types.ImgParsSt{Width: 20, Format: "jpeg"}, false)
+	require.Nil(t, err)
+	require.Equal(t, int64(3), srcGetCount())
+
+	_, _, _, err = getStatic(t, cr, fPath, &types.ImgParsSt{Width: 20, Format: "jpeg"}, false)
+	require.Nil(t, err)
+	require.Equal(t, int64(4), srcGetCount())
+}
+
+func TestCacheAdmin(t *testing.T) {
+	adminCore := newTestCore(storageMem.New(), storageMem.New(), func(conf *core.ConfSt) {
+		conf.AuthApiKeys = map[string]*types.AuthScopeSt{
+			"key1": {Dirs: []string{types.AuthScopeAll}},
+			"key2": {Dirs: []string{types.AuthScopeAll}, Admin: true},
+		}
+		conf.CacheCount = 100
+		conf.DiskCacheSize = 1024 * 1024
+	})
+
+	handler := rest.GetHandler(app.lg, adminCore, false, map[string]string{
+		"thumb": "w=10&h=10&m=fit",
+		"small": "w=20&fmt=jpeg",
+	}, false)
+
+	request := func(method, uri, token, body string, repObj any) int {
+		req := httptest.NewRequest(method, uri, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code == http.StatusOK && repObj != nil {
+			require.Nil(t, json.Unmarshal(rec.Body.Bytes(), repObj))
+		}
+
+		return rec.Code
+	}
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(100, 100, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err := adminCore.Static.Create("photos", "a.png", srcImgBuffer, true, false, nil)
+	require.Nil(t, err)
+
+	// access
+	require.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/cache/stats", "", "", nil))
+	require.Equal(t, http.StatusForbidden, request(http.MethodGet, "/cache/stats", "key1", "", nil))
+	require.Equal(t, http.StatusForbidden, request(http.MethodPost, "/cache/purge", "key1", `{"all":true}`, nil))
+	require.Equal(t, http.StatusForbidden, request(http.MethodPost, "/cache/warmup", "key1", `{}`, nil))
+
+	// warm-up
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/cache/warmup", "key2", `{"paths":["`+fPath+`"],"presets":["unknown"]}`, nil))
+
+	warmUpRep := &rest.CacheWarmUpRepSt{}
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/cache/warmup", "key2", `{"paths":["`+fPath+`","photos/none.png"],"presets":["thumb","small"]}`, warmUpRep))
+	require.Equal(t, 2, warmUpRep.Done)
+	require.Len(t, warmUpRep.Errors, 2)
+	require.Contains(t, warmUpRep.Errors, "photos/none.png?thumb")
+
+	statsRep := &rest.CacheStatsRepSt{}
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/cache/stats", "key2", "", statsRep))
+	require.Equal(t, 2, statsRep.Memory.Count)
+	require.Equal(t, 100, statsRep.Memory.MaxCount)
+	require.Equal(t, int64(0), statsRep.Memory.Hits)
+	require.Equal(t, 2, statsRep.Disk.Count)
+	require.Equal(t, int64(1024*1024), statsRep.Disk.MaxSize)
+
+	_, _, _, err = getStatic(t, adminCore, fPath, &types.ImgParsSt{Width: 10, Height: 10, Method: "fit"}, false)
+	require.Nil(t, err)
+
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/cache/stats", "key2", "", statsRep))
+	require.Equal(t, int64(1), statsRep.Memory.Hits)
+
+	// purge
+	purgeRep := &rest.CachePurgeRepSt{}
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/cache/purge", "key2", `{}`, nil))
+
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/cache/purge", "key2", `{"key":"unknown"}`, purgeRep))
+	require.Equal(t, 0, purgeRep.Removed)
+
+	thumbPars := &types.ImgParsSt{Width: 10, Height: 10, Method: "fit"}
+
+	// memory and disk entries of key
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/cache/purge", "key2", `{"key":"`+adminCore.Cache.GenerateKey(fPath, thumbPars, false)+`"}`, purgeRep))
+	require.Equal(t, 2, purgeRep.Removed)
+
+	// disk tier does not serve purged entry
+	_, _, _, err = getStatic(t, adminCore, fPath, thumbPars, false)
+	require.Nil(t, err)
+
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/cache/stats", "key2", "", statsRep))
+	require.Equal(t, int64(0), statsRep.Disk.Hits)
+	require.Equal(t, 2, statsRep.Disk.Count)
+
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/cache/purge", "key2", `{"prefix":"photos"}`, purgeRep))
+	require.Equal(t, 4, purgeRep.Removed)
+
+	_, _, _, err = getStatic(t, adminCore, fPath, thumbPars, false)
+	require.Nil(t, err)
+
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/cache/stats", "key2", "", statsRep))
+	require.Equal(t, int64(0), statsRep.Disk.Hits)
+	require.Equal(t, 1, statsRep.Disk.Count)
+
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/cache/purge", "key2", `{"all":true}`, purgeRep))
+	require.Equal(t, 2, purgeRep.Removed)
+
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/cache/stats", "key2", "", statsRep))
+	require.Equal(t, 0, statsRep.Memory.Count)
+	require.Equal(t, 0, statsRep.Disk.Count)
+	require.Equal(t, int64(0), statsRep.Disk.Size)
+
+	// warm-up with auto format creates webp derivatives too
+	autoFormatCore := newTestCore(storageMem.New(), nil, func(conf *core.ConfSt) {
+		conf.ImgAutoFormat = true
+		conf.CacheCount = 100
+	})
+
+	srcImgBuffer = new(bytes.Buffer)
+
+	err = imaging.Encode(srcImgBuffer, imaging.New(100, 100, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	fPath, err = autoFormatCore.Static.Create("photos", "a.png", srcImgBuffer, true, false, nil)
+	require.Nil(t, err)
+
+	done, warmUpErrs := autoFormatCore.Cache.WarmUp([]string{fPath, "photos/none.png"}, map[string]*types.ImgParsSt{
+		"thumb": {Width: 10, Height: 10, Method: "fit"},
+		"small": {Width: 20, Format: "jpeg"},
+	})
+	require.Equal(t, 3, done)
+	require.Len(t, warmUpErrs, 3)
+	require.Contains(t, warmUpErrs, "photos/none.png?thumb&format=webp")
+
+	webpThumbPars := &types.ImgParsSt{Width: 10, Height: 10, Method: "fit", Format: "webp"}
+
+	_, _, _, err = getStatic(t, autoFormatCore, fPath, webpThumbPars, false)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), autoFormatCore.Cache.GetStats().Hits)
+}
+
+func TestCreateZip(t *testing.T) {
+	cleanTestDir()
+
+	zipContentIsSame := func(a, b []fsItemSt) {
+		require.Equal(t, len(a), len(b))
+
+		for _, ai := range a {
+			found := false
+
+			for _, bi := range b {
+				if bi.p == ai.p {
+					found = true
+					require.Equal(t, ai.c, bi.c)
+					break
+				}
+			}
+
+			require.True(t, found)
+		}
+
+		for _, bi := range b {
+			found := false
+
+			for _, ai := range a {
+				if ai.p == bi.p {
+					found = true
+					require.Equal(t, bi.c, ai.c)
+					break
+				}
+			}
+
+			require.True(t, found)
+		}
+	}
+
+	srcZipFiles := []fsItemSt{
+		{p: "index.html", c: "some html content"},
+		{p: "abc/file.txt", c: "file content"},
+		{p: "abc/qwe/x.txt", c: "x content"},
+		{p: "todo.txt", c: "todo content"},
+	}
+
+	zipBuffer, err := createZipArchive(srcZipFiles)
+	require.Nil(t, err)
+
+	_, err = app.core.Static.Create("zip/"+cns.ZipDirNamePrefix+"_asd", "a.zip", zipBuffer, false, true, nil)
+	require.NotNil(t, err)
+	require.Equal(t, errs.BadDirName, err)
+
+	_, err = app.core.Static.Create(cns.ZipDirNamePrefix+"_asd/zip", "a.zip", zipBuffer, false, true, nil)
+	require.NotNil(t, err)
+	require.Equal(t, errs.BadDirName, err)
+
+	fPath, err := app.core.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(fPath, "/"))
+
+	for _, zp := range srcZipFiles {
+		_, _, fContent, err := getStatic(t, app.core, fPath+zp.p, &types.ImgParsSt{}, false)
+		require.Nil(t, err)
+		require.NotNil(t, fContent)
+		require.Equal(t, zp.c, string(fContent))
+	}
+
+	fName, _, fContent, err := getStatic(t, app.core, fPath, &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	require.Equal(t, "index.html", fName)
+	require.NotNil(t, fContent)
+	require.Equal(t, "some html content", string(fContent))
+
+	fName, _, fContent, err = getStatic(t, app.core, fPath, &types.ImgParsSt{}, true)
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(fName, ".zip"))
+	require.NotNil(t, fContent)
+
+	resultZipFiles, err := extractZipArchive(fContent)
+	require.Nil(t, err)
+	zipContentIsSame(srcZipFiles, resultZipFiles)
+
+	srcZipFiles = []fsItemSt{
+		{p: "root/index.html", c: "some html content"},
+		{p: "root/abc/file.txt", c: "file content"},
+		{p: "root/abc/qwe/x.txt", c: "x content"},
+		{p: "root/todo.txt", c: "todo content"},
+	}
+
+	zipBuffer, err = createZipArchive(srcZipFiles)
+	require.Nil(t, err)
+
+	fPath, err = app.core.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(fPath, "/"))
+
+	for _, zp := range srcZipFiles {
+		_, _, fContent, err := getStatic(t, app.core, fPath+strings.TrimPrefix(zp.p, "root/"), &types.ImgParsSt{}, false)
+		require.Nil(t, err)
+		require.NotNil(t, fContent)
+		require.Equal(t, zp.c, string(fContent))
+	}
+
+	fName, _, fContent, err = getStatic(t, app.core, fPath, &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	require.Equal(t, "index.html", fName)
+	require.NotNil(t, fContent)
+	require.Equal(t, "some html content", string(fContent))
+}
+
+func TestCreateZipLimits(t *testing.T) {
+	cleanTestDir()
+
+	requireBadArchive := func(err error) {
+		require.NotNil(t, err)
+		errWithDesc, ok := err.(dopErrs.ErrWithDesc)
+		require.True(t, ok, "unexpected error %v", err)
+		require.Equal(t, errs.BadArchive, errWithDesc.Err)
+	}
+
+	zipBuffer, err := createZipArchive([]fsItemSt{
+		{p: "index.html", c: "content"},
+		{p: "../evil.txt", c: "evil"},
+	})
+	require.Nil(t, err)
+	_, err = app.core.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	requireBadArchive(err)
+
+	zipBuffer, err = createZipArchive([]fsItemSt{
+		{p: "root/index.html", c: "content"},
+		{p: "root/../../evil.txt", c: "evil"},
+	})
+	require.Nil(t, err)
+	_, err = app.core.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	requireBadArchive(err)
+
+	manyItems := make([]fsItemSt, 0, zipMaxEntries+1)
+	for i := 0; i <= zipMaxEntries; i++ {
+		manyItems = append(manyItems, fsItemSt{p: "f" + strconv.Itoa(i) + ".txt", c: "content"})
+	}
+	zipBuffer, err = createZipArchive(manyItems)
+	require.Nil(t, err)
+	_, err = app.core.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	requireBadArchive(err)
+
+	zipBuffer, err = createZipArchive([]fsItemSt{
+		{p: "large.txt", c: strings.Repeat("0", zipMaxFileSize+1)},
+	})
+	require.Nil(t, err)
+	_, err = app.core.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	requireBadArchive(err)
+
+	zipBuffer, err = createZipArchive([]fsItemSt{
+		{p: "bomb.txt", c: strings.Repeat("0", 2*1024*1024)},
+	})
+	require.Nil(t, err)
+	_, err = app.core.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	requireBadArchive(err)
+
+	_, err = app.core.Static.Create("zip", "a.zip", bytes.NewBufferString("not a zip"), false, true, nil)
+	requireBadArchive(err)
+
+	// failed extractions must not leave anything
+	compareDirStructure(t, testDirPath, []fsItemSt{})
+
+	zipBuffer, err = createZipArchive([]fsItemSt{
+		{p: "root/tree.txt", c: "tree content"},
+		{p: "root/other.txt", c: "other content"},
+	})
+	require.Nil(t, err)
+	fPath, err := app.core.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	require.Nil(t, err)
+
+	_, _, fContent, err := getStatic(t, app.core, fPath+"tree.txt", &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	require.Equal(t, "tree content", string(fContent))
+
+	_, _, fContent, err = getStatic(t, app.core, fPath+"other.txt", &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	require.Equal(t, "other content", string(fContent))
+}
+
+func TestRemove(t *testing.T) {
+	cleanTestDir()
+
+	dateDirPath := filepath.Join(testDirPath, "photos", filepath.FromSlash(util.GetDateUrlPath()))
+
+	fPath1, err := app.core.Static.Create("photos", "a.txt", bytes.NewBuffer([]byte("test_data")), true, false, nil)
+	require.Nil(t, err)
+
+	fPath2, err := app.core.Static.Create("photos", "b.txt", bytes.NewBuffer([]byte("test_data")), true, false, nil)
+	require.Nil(t, err)
+
+	zipBuffer, err := createZipArchive([]fsItemSt{
+		{p: "index.html", c: "index"},
+		{p: "js/a.js", c: "a"},
+	})
+	require.Nil(t, err)
+
+	zipPath, err := app.core.Static.Create("photos", "a.zip", zipBuffer, true, true, nil)
+	require.Nil(t, err)
+
+	for _, p := range []string{"", "photos", "photos/" + util.GetDateUrlPath(), zipPath + "js/a.js", cns.KvsDirNamePrefix + "/a"} {
+		require.Equal(t, errs.BadDirName, app.core.Static.Remove(p), p)
+	}
+
+	require.Equal(t, dopErrs.ObjectNotFound, app.core.Static.Remove("photos/none.txt"))
+
+	require.Nil(t, app.core.Static.Remove(fPath1))
+	_, err = app.core.Static.Get(fPath1, &types.ImgParsSt{}, false)
+	require.Equal(t, dopErrs.ObjectNotFound, err)
+
+	require.Nil(t, app.core.Static.Remove(zipPath))
+	_, err = app.core.Static.Get(zipPath, &types.ImgParsSt{}, false)
+	require.Equal(t, dopErrs.ObjectNotFound, err)
+	require.True(t, util.FsPathIsDir(dateDirPath))
+
+	handler := rest.GetHandler(app.lg, app.core, false, nil, false)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/static/"+fPath2, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// empty date dirs are removed
+	require.False(t, util.FsPathIsDir(filepath.Join(testDirPath, "photos", time.Now().Format("2006"))))
+	require.True(t, util.FsPathIsDir(filepath.Join(testDirPath, "photos")))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/static/"+fPath2, nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	// dir removal is non-recursive, file uploaded concurrently into "empty" dir is kept
+	for _, st := range []storage.Storage{storageLocal.New(testDirPath), storageMem.New()} {
+		require.Nil(t, st.Put("photos/x/a.txt", bytes.NewBuffer([]byte("test_data"))))
+
+		require.ErrorIs(t, st.RemoveDir("photos/x"), fs.ErrExist)
+		require.ErrorIs(t, st.RemoveDir("photos"), fs.ErrExist)
+
+		_, err = st.Stat("photos/x/a.txt")
+		require.Nil(t, err)
+
+		require.Nil(t, st.Rename("photos/x/a.txt", "photos/y/b.txt"))
+		_, err = st.Stat("photos/y/b.txt")
+		require.Nil(t, err)
+		require.ErrorIs(t, st.Rename("photos/x/a.txt", "photos/y/c.txt"), fs.ErrNotExist)
+
+		require.Nil(t, st.Remove("photos/y"))
+		require.Nil(t, st.RemoveDir("photos/x"))
+
+		_, err = st.Stat("photos/x")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	}
+}
+
+func TestCleanEmptyDirs(t *testing.T) {
+	cleanTestDir()
+
+	// file is uploaded into empty dir after walk of removeEmptyDirs
+	walkCount := 0
+	st := &walkHookStorageSt{Storage: storageLocal.New(testDirPath), afterWalk: func(s storage.Storage) {
+		walkCount++
+		if walkCount == 2 {
+			require.Nil(t, s.Put("photos/late/a.txt", bytes.NewBuffer([]byte("test_data"))))
+		}
+	}}
+
+	cleanCore := newTestCore(st, nil, nil)
+
+	require.Nil(t, os.MkdirAll(filepath.Join(testDirPath, "photos", "empty", "sub"), os.ModePerm))
+	require.Nil(t, os.MkdirAll(filepath.Join(testDirPath, "photos", "late"), os.ModePerm))
+
+	cleanCore.Clean.Clean(0)
+	require.Equal(t, 2, walkCount)
+
+	require.False(t, util.FsPathIsDir(filepath.Join(testDirPath, "photos", "empty")))
+
+	_, err := st.Stat("photos/late/a.txt")
+	require.Nil(t, err)
+}
+
+func TestCreatePutFail(t *testing.T) {
+	cleanTestDir()
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(2000, 1000, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	for _, failedPut := range []int{1, 2} { // source, downscaled
+		st := &failingPutStorageSt{Storage: storageLocal.New(testDirPath), failedPut: failedPut}
+
+		_, err = newTestCore(st, nil, nil).Static.Create("photos", "a.png", bytes.NewReader(srcImgBuffer.Bytes()), false, false, nil)
+		require.NotNil(t, err)
+
+		// truncated file is removed
+		entries, _ := os.ReadDir(filepath.Join(testDirPath, "photos", filepath.FromSlash(util.GetDateUrlPath())))
+		require.Empty(t, entries, failedPut)
+	}
+}
+
+func TestList(t *testing.T) {
+	memStorage := storageMem.New()
+
+	listCore := newTestCore(memStorage, nil, func(conf *core.ConfSt) {
+		conf.ZipLimits = types.ZipLimitsSt{MaxRatio: zipMaxRatio}
+		conf.AuthApiKeys = map[string]*types.AuthScopeSt{
+			"key1": {Dirs: []string{"photos"}},
+			"key2": {Dirs: []string{types.AuthScopeAll}},
+			"key3": {Dirs: []string{"docs"}},
+			"key4": {Dirs: []string{"docs"}, Admin: true},
+		}
+		conf.PrivateDirPaths = []string{"docs"}
+	})
+
+	dateUrlPath := "photos/" + util.GetDateUrlPath()
+
+	fPath1, err := listCore.Static.Create("photos", "a.txt", bytes.NewBuffer([]byte("1")), true, false, nil)
+	require.Nil(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+
+	fPath2, err := listCore.Static.Create("photos", "b.txt", bytes.NewBuffer([]byte("123")), true, false, nil)
+	require.Nil(t, err)
+
+	zipBuffer, err := createZipArchive([]fsItemSt{{p: "index.html", c: "index"}})
+	require.Nil(t, err)
+
+	zipPath, err := listCore.Static.Create("photos", "a.zip", zipBuffer, true, true, nil)
+	require.Nil(t, err)
+
+	err = listCore.Kvs.Set("a", bytes.NewBuffer([]byte("v")))
+	require.Nil(t, err)
+
+	itemPaths := func(items []*types.StaticListItemSt) []string {
+		result := make([]string, 0, len(items))
+		for _, item := range items {
+			result = append(result, item.Path)
+		}
+		return result
+	}
+
+	items, totalCount, err := listCore.Static.List("/"+dateUrlPath+"/", &types.StaticListParsSt{SortName: "size"})
+	require.Nil(t, err)
+	require.Equal(t, int64(3), totalCount)
+	require.Equal(t, []string{zipPath, fPath1, fPath2}, itemPaths(items))
+	require.True(t, items[0].IsDir)
+	require.True(t, items[0].IsZipDir)
+	require.Equal(t, int64(0), items[0].Size)
+	require.False(t, items[2].IsDir)
+	require.Equal(t, int64(3), items[2].Size)
+
+	items, totalCount, err = listCore.Static.List(dateUrlPath, &types.StaticListParsSt{SortName: "size", SortDesc: true, Page: 1, PageSize: 2})
+	require.Nil(t, err)
+	require.Equal(t, int64(3), totalCount)
+	require.Equal(t, []string{zipPath}, itemPaths(items))
+
+	items, _, err = listCore.Static.List(dateUrlPath, &types.StaticListParsSt{SortName: "mtime", Page: 5})
+	require.Nil(t, err)
+	require.Empty(t, items)
+
+	// kvs dir is hidden
+	items, totalCount, err = listCore.Static.List("", &types.StaticListParsSt{})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), totalCount)
+	require.Equal(t, []string{"photos"}, itemPaths(items))
+
+	_, _, err = listCore.Static.List(dateUrlPath, &types.StaticListParsSt{SortName: "bad"})
+	require.Equal(t, errs.BadListSort, err)
+
+	_, _, err = listCore.Static.List(cns.KvsDirNamePrefix, &types.StaticListParsSt{})
+	require.Equal(t, errs.BadDirName, err)
+
+	_, _, err = listCore.Static.List("docs", &types.StaticListParsSt{})
+	require.Equal(t, dopErrs.ObjectNotFound, err)
+
+	_, _, err = listCore.Static.List(fPath1, &types.StaticListParsSt{})
+	require.Equal(t, dopErrs.ObjectNotFound, err)
+
+	// rest
+	handler := rest.GetHandler(app.lg, listCore, false, nil, false)
+
+	request := func(uri, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, uri, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	require.Equal(t, http.StatusUnauthorized, request("/list/photos", "").Code)
+	require.Equal(t, http.StatusForbidden, request("/list/", "key1").Code)
+	require.Equal(t, http.StatusNotFound, request("/list/photos/none", "key1").Code)
+
+	rec := request("/list/"+dateUrlPath+"?sort_name=name&page_size=2", "key1")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	repObj := &rest.ListRepSt{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), repObj))
+	require.Equal(t, int64(2), repObj.PageSize)
+	require.Equal(t, int64(3), repObj.TotalCount)
+	require.Len(t, repObj.Results, 2)
+
+	require.Equal(t, http.StatusOK, request("/list/", "key2").Code)
+
+	// private dir
+	_, err = listCore.Static.Create("docs", "a.txt", bytes.NewBuffer([]byte("1")), true, false, nil)
+	require.Nil(t, err)
+
+	require.Equal(t, http.StatusForbidden, request("/list/docs", "key3").Code)
+	require.Equal(t, http.StatusForbidden, request("/list/docs/"+util.GetDateUrlPath(), "key3").Code)
+	require.Equal(t, http.StatusOK, request("/list/docs/"+util.GetDateUrlPath(), "key4").Code)
+}
+
+func TestMeta(t *testing.T) {
+	srcStorage := &blockingStorageSt{Storage: storageMem.New(), unblock: make(chan struct{})}
+	close(srcStorage.unblock)
+
+	metaCore := newTestCore(srcStorage, nil, func(conf *core.ConfSt) {
+		conf.CacheCount = 10
+	})
+
+	srcImgBuffer := new(bytes.Buffer)
+
+	err := imaging.Encode(srcImgBuffer, imaging.New(200, 100, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	srcImgSha256 := sha256.Sum256(srcImgBuffer.Bytes())
+	srcImgSize := int64(srcImgBuffer.Len())
+
+	imgPath, err := metaCore.Static.Create("photos", "a.png", srcImgBuffer, true, false, nil)
 	require.Nil(t, err)
 
-	_, _, fContent, err = app.core.Static.Get(fPath, &types.ImgParsSt{}, false)
+	txtPath, err := metaCore.Static.Create("docs", "a.txt", bytes.NewBuffer([]byte("test_data")), true, false, nil)
 	require.Nil(t, err)
-	require.NotNil(t, fContent)
 
-	img, err := imaging.Decode(bytes.NewBuffer(fContent))
+	binPath, err := metaCore.Static.Create("docs", "a", bytes.NewBuffer([]byte("<html><body></body></html>")), true, false, nil)
 	require.Nil(t, err)
 
-	imgBounds := img.Bounds().Max
-	require.Equal(t, imgMaxWidth+10, imgBounds.X)
-	require.Equal(t, imgMaxHeight+10, imgBounds.X)
+	meta, err := metaCore.Static.GetMeta(imgPath)
+	require.Nil(t, err)
+	require.Equal(t, path.Base(imgPath), meta.Name)
+	require.Equal(t, srcImgSize, meta.Size)
+	require.Equal(t, "image/png", meta.ContentType)
+	require.Equal(t, hex.EncodeToString(srcImgSha256[:]), meta.Sha256)
+	require.Equal(t, 200, meta.Width)
+	require.Equal(t, 100, meta.Height)
+	require.Equal(t, "landscape", meta.Orientation)
+	require.False(t, meta.ModTime.IsZero())
+
+	// cached
+	getCount := atomic.LoadInt64(&srcStorage.getCount)
+
+	meta2, err := metaCore.Static.GetMeta(imgPath)
+	require.Nil(t, err)
+	require.Equal(t, meta.Sha256, meta2.Sha256)
+	require.Equal(t, getCount, atomic.LoadInt64(&srcStorage.getCount))
 
-	largeImg = imaging.New(imgMaxWidth+10, imgMaxHeight+10, color.RGBA{R: 0xaa, G: 0x00, B: 0x00, A: 0xff})
-	require.NotNil(t, largeImg)
+	// file is changed
+	time.Sleep(10 * time.Millisecond)
 
-	largeImgBuffer = new(bytes.Buffer)
+	srcImgBuffer.Reset()
+	err = imaging.Encode(srcImgBuffer, imaging.New(50, 100, color.Black), imaging.PNG)
+	require.Nil(t, err)
+	err = srcStorage.Storage.Put(imgPath, srcImgBuffer)
+	require.Nil(t, err)
 
-	err = imaging.Encode(largeImgBuffer, largeImg, imaging.JPEG)
+	meta, err = metaCore.Static.GetMeta(imgPath)
 	require.Nil(t, err)
+	require.NotEqual(t, meta2.Sha256, meta.Sha256)
+	require.Equal(t, "portrait", meta.Orientation)
 
-	fPath, err = app.core.Static.Create("photos", "a.jpg", largeImgBuffer, false, false)
+	// exif orientation is applied without decoding
+	srcImgBuffer.Reset()
+	err = imaging.Encode(srcImgBuffer, imaging.New(200, 100, color.White), imaging.JPEG)
 	require.Nil(t, err)
 
-	_, _, fContent, err = app.core.Static.Get(fPath, &types.ImgParsSt{}, false)
+	exifData := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08" + // tiff header, IFD0 offset
+		"\x00\x01" + // tag count
+		"\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00" + // orientation (short) = 6
+		"\x00\x00\x00\x00") // next IFD
+
+	jpegData := append([]byte{0xff, 0xd8, 0xff, 0xe1, 0, byte(len(exifData) + 2)}, exifData...)
+	jpegData = append(jpegData, srcImgBuffer.Bytes()[2:]...)
+
+	jpegPath, err := metaCore.Static.Create("photos", "b.jpg", bytes.NewBuffer(jpegData), true, false, nil)
 	require.Nil(t, err)
-	require.NotNil(t, fContent)
 
-	img, err = imaging.Decode(bytes.NewBuffer(fContent))
+	meta, err = metaCore.Static.GetMeta(jpegPath)
 	require.Nil(t, err)
+	require.Equal(t, 100, meta.Width)
+	require.Equal(t, 200, meta.Height)
+	require.Equal(t, "portrait", meta.Orientation)
 
-	imgBounds = img.Bounds().Max
-	require.Equal(t, imgMaxWidth, imgBounds.X)
-	require.Equal(t, imgMaxHeight, imgBounds.X)
+	// checksum of upload is used, file is not read
+	getCount = atomic.LoadInt64(&srcStorage.getCount)
 
-	_, _, fContent, err = app.core.Static.Get(fPath, &types.ImgParsSt{Method: "fit", Width: imgMaxWidth - 10, Height: imgMaxHeight - 10}, false)
+	txtPath2, err := metaCore.Static.Create("docs", "b.txt", bytes.NewBuffer([]byte("test_data")), true, false, nil)
 	require.Nil(t, err)
-	require.NotNil(t, fContent)
 
-	img, err = imaging.Decode(bytes.NewBuffer(fContent))
+	meta, err = metaCore.Static.GetMeta(txtPath2)
 	require.Nil(t, err)
+	require.Equal(t, getCount, atomic.LoadInt64(&srcStorage.getCount))
 
-	imgBounds = img.Bounds().Max
-	require.Equal(t, imgMaxWidth-10, imgBounds.X)
-	require.Equal(t, imgMaxHeight-10, imgBounds.X)
+	txtSha256 := sha256.Sum256([]byte("test_data"))
+	require.Equal(t, hex.EncodeToString(txtSha256[:]), meta.Sha256)
 
-	_, _, fContent, err = app.core.Static.Get(fPath, &types.ImgParsSt{Method: "fit", Width: imgMaxWidth + 10, Height: imgMaxHeight + 10}, false)
+	meta, err = metaCore.Static.GetMeta(txtPath)
 	require.Nil(t, err)
-	require.NotNil(t, fContent)
+	require.Equal(t, int64(9), meta.Size)
+	require.True(t, strings.HasPrefix(meta.ContentType, "text/plain"))
+	require.Zero(t, meta.Width)
+	require.Empty(t, meta.Orientation)
 
-	img, err = imaging.Decode(bytes.NewBuffer(fContent))
+	meta, err = metaCore.Static.GetMeta(binPath)
 	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(meta.ContentType, "text/html"))
 
-	imgBounds = img.Bounds().Max
-	require.Equal(t, imgMaxWidth, imgBounds.X)
-	require.Equal(t, imgMaxHeight, imgBounds.X)
-}
+	_, err = metaCore.Static.GetMeta("photos")
+	require.Equal(t, dopErrs.ObjectNotFound, err)
 
-func TestCreateZip(t *testing.T) {
-	cleanTestDir()
+	_, err = metaCore.Static.GetMeta("photos/none.png")
+	require.Equal(t, dopErrs.ObjectNotFound, err)
 
-	zipContentIsSame := func(a, b []fsItemSt) {
-		require.Equal(t, len(a), len(b))
+	// rest
+	handler := rest.GetHandler(app.lg, metaCore, false, nil, false)
 
-		for _, ai := range a {
-			found := false
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/meta/"+txtPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
 
-			for _, bi := range b {
-				if bi.p == ai.p {
-					found = true
-					require.Equal(t, ai.c, bi.c)
-					break
-				}
-			}
+	repObj := &types.StaticMetaSt{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), repObj))
+	require.Equal(t, int64(9), repObj.Size)
 
-			require.True(t, found)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/meta/docs/none.txt", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/static/"+txtPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "9", rec.Header().Get("Content-Length"))
+	require.Zero(t, rec.Body.Len())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/static/docs/none.txt", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUploadMeta(t *testing.T) {
+	memStorage := storageMem.New()
+
+	metaCore := newTestCore(memStorage, nil, func(conf *core.ConfSt) {
+		conf.AuthApiKeys = map[string]*types.AuthScopeSt{
+			"key1": {Dirs: []string{types.AuthScopeAll}},
 		}
+		conf.CacheCount = 10
+	})
 
-		for _, bi := range b {
-			found := false
+	handler := rest.GetHandler(app.lg, metaCore, false, nil, false)
 
-			for _, ai := range a {
-				if ai.p == bi.p {
-					found = true
-					require.Equal(t, bi.c, ai.c)
-					break
-				}
-			}
+	upload := func(fileName string, data []byte, tags string) *httptest.ResponseRecorder {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
 
-			require.True(t, found)
+		require.Nil(t, mw.WriteField("dir", "docs"))
+		require.Nil(t, mw.WriteField("no_cut", "true"))
+		if tags != "" {
+			require.Nil(t, mw.WriteField("tags", tags))
 		}
+
+		fw, err := mw.CreateFormFile("file", fileName)
+		require.Nil(t, err)
+		_, err = fw.Write(data)
+		require.Nil(t, err)
+		require.Nil(t, mw.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/static", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer key1")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
 	}
 
-	srcZipFiles := []fsItemSt{
-		{p: "index.html", c: "some html content"},
-		{p: "abc/file.txt", c: "file content"},
-		{p: "abc/qwe/x.txt", c: "x content"},
-		{p: "todo.txt", c: "todo content"},
+	get := func(uri string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, uri, nil))
+		return rec
 	}
 
-	zipBuffer, err := createZipArchive(srcZipFiles)
+	require.Equal(t, http.StatusBadRequest, upload("report.txt", []byte("data"), "not-json").Code)
+
+	rec := upload("Отчёт 2024.txt", []byte("test_data"), `{"owner":"123"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	saveRep := &rest.SaveRepSt{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), saveRep))
+
+	dataSha256 := sha256.Sum256([]byte("test_data"))
+
+	uploadMeta, err := metaCore.Static.GetUploadMeta(saveRep.Path)
 	require.Nil(t, err)
+	require.NotNil(t, uploadMeta)
+	require.Equal(t, "Отчёт 2024.txt", uploadMeta.OriginalName)
+	require.True(t, strings.HasPrefix(uploadMeta.Uploader, "key:"))
+	require.NotContains(t, uploadMeta.Uploader, "key1")
+	require.True(t, strings.HasPrefix(uploadMeta.ContentType, "text/plain"))
+	require.Equal(t, int64(9), uploadMeta.Size)
+	require.Equal(t, hex.EncodeToString(dataSha256[:]), uploadMeta.Sha256)
+	require.Equal(t, map[string]string{"owner": "123"}, uploadMeta.Tags)
+	require.False(t, uploadMeta.CreatedAt.IsZero())
+
+	// public meta contains only original name
+	rec = get("/meta/" + saveRep.Path)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"original_name":"Отчёт 2024.txt"`)
+	require.NotContains(t, rec.Body.String(), "owner")
+	require.NotContains(t, rec.Body.String(), uploadMeta.Uploader)
+
+	// sidecars and kvs are not served
+	sidecarPath := cns.MetaDirNamePrefix + "/" + saveRep.Path + ".json"
+
+	sidecar, err := memStorage.Get(sidecarPath)
+	require.Nil(t, err)
+	require.Nil(t, sidecar.Close())
 
-	_, err = app.core.Static.Create("zip/"+cns.ZipDirNamePrefix+"_asd", "a.zip", zipBuffer, false, true)
-	require.NotNil(t, err)
+	require.Equal(t, http.StatusNotFound, get("/static/"+sidecarPath).Code)
+	require.Equal(t, http.StatusNotFound, get("/meta/"+sidecarPath).Code)
+
+	err = metaCore.Kvs.Set("a", bytes.NewBuffer([]byte("v")))
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotFound, get("/static/"+cns.KvsDirNamePrefix+"/a").Code)
+
+	// default Content-Disposition
+	rec = get("/static/" + saveRep.Path)
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, dispositionPars, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+	require.Nil(t, err)
+	require.Equal(t, "Отчёт 2024.txt", dispositionPars["filename"])
+
+	rec = get("/static/" + saveRep.Path + "?download=a")
+	require.Equal(t, `attachment; filename="a.txt"`, rec.Header().Get("Content-Disposition"))
+
+	// extension follows the format conversion
+	srcImgBuffer := new(bytes.Buffer)
+
+	err = imaging.Encode(srcImgBuffer, imaging.New(20, 20, color.White), imaging.PNG)
+	require.Nil(t, err)
+
+	imgPath, err := metaCore.Static.Create("photos", "cat.png", srcImgBuffer, true, false, nil)
+	require.Nil(t, err)
+
+	rec = get("/static/" + imgPath + "?fmt=jpeg")
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, dispositionPars, err = mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+	require.Nil(t, err)
+	require.Equal(t, "cat.jpg", dispositionPars["filename"])
+
+	// files without meta
+	err = memStorage.Put("docs/old.txt", bytes.NewBuffer([]byte("old")))
+	require.Nil(t, err)
+
+	rec = get("/static/docs/old.txt")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Content-Disposition"))
+
+	uploadMeta, err = metaCore.Static.GetUploadMeta("docs/old.txt")
+	require.Nil(t, err)
+	require.Nil(t, uploadMeta)
+
+	// metas do not use derivatives cache
+	smallCore := newTestCore(memStorage, nil, func(conf *core.ConfSt) {
+		conf.CacheCount = 3
+	})
+
+	_, _, _, err = getStatic(t, smallCore, imgPath, &types.ImgParsSt{Width: 10}, false)
+	require.Nil(t, err)
+
+	for _, p := range []string{saveRep.Path, imgPath, "docs/old.txt"} {
+		_, _, _, err = getStatic(t, smallCore, p, &types.ImgParsSt{}, false)
+		require.Nil(t, err)
+
+		_, err = smallCore.Static.GetMeta(p)
+		require.Nil(t, err)
+	}
+
+	cacheStats := smallCore.Cache.GetStats()
+	require.Equal(t, 1, cacheStats.Count)
+	require.Equal(t, int64(0), cacheStats.Hits)
+	require.Equal(t, int64(4), cacheStats.Misses) // one per Static.Get
+
+	_, _, _, err = getStatic(t, smallCore, imgPath, &types.ImgParsSt{Width: 10}, false)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), smallCore.Cache.GetStats().Hits)
+
+	// meta dir is protected and hidden
+	_, err = metaCore.Static.Create(cns.MetaDirNamePrefix, "a.txt", bytes.NewBuffer([]byte("a")), true, false, nil)
 	require.Equal(t, errs.BadDirName, err)
 
-	_, err = app.core.Static.Create(cns.ZipDirNamePrefix+"_asd/zip", "a.zip", zipBuffer, false, true)
-	require.NotNil(t, err)
+	_, _, err = metaCore.Static.List(cns.MetaDirNamePrefix, &types.StaticListParsSt{})
 	require.Equal(t, errs.BadDirName, err)
 
-	fPath, err := app.core.Static.Create("zip", "a.zip", zipBuffer, false, true)
+	items, _, err := metaCore.Static.List("", &types.StaticListParsSt{})
 	require.Nil(t, err)
-	require.True(t, strings.HasSuffix(fPath, "/"))
+	for _, item := range items {
+		require.NotEqual(t, cns.MetaDirNamePrefix, item.Name)
+	}
 
-	for _, zp := range srcZipFiles {
-		_, _, fContent, err := app.core.Static.Get(fPath+zp.p, &types.ImgParsSt{}, false)
+	// removed with file
+	require.Nil(t, metaCore.Static.Remove(saveRep.Path))
+
+	metaFileCount := 0
+	err = memStorage.Walk(cns.MetaDirNamePrefix, func(p string, info *storage.FileInfoSt, err error) error {
+		if err == nil && !info.IsDir {
+			metaFileCount++
+		}
+		return err
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, metaFileCount) // cat.png
+}
+
+func TestAuth(t *testing.T) {
+	const jwtSecret = "jwt_secret"
+
+	authCore := newTestCore(storageMem.New(), nil, func(conf *core.ConfSt) {
+		conf.AuthApiKeys = map[string]*types.AuthScopeSt{
+			"key1": {Dirs: []string{"photos", "/docs/a/"}, KvsPrefixes: []string{"cfg_"}},
+			"key2": {Dirs: []string{types.AuthScopeAll}, Admin: true},
+		}
+		conf.AuthJwtSecret = jwtSecret
+	})
+
+	scope, err := app.core.Auth.GetScope("")
+	require.Nil(t, err)
+	require.True(t, scope.Admin)
+	require.True(t, scope.HasDir("any"))
+	require.True(t, scope.HasKvsKey("any"))
+
+	_, err = authCore.Auth.GetScope("")
+	require.Equal(t, dopErrs.NotAuthorized, err)
+
+	_, err = authCore.Auth.GetScope("bad_key")
+	require.Equal(t, dopErrs.NotAuthorized, err)
+
+	scope, err = authCore.Auth.GetScope("key1")
+	require.Nil(t, err)
+	require.False(t, scope.Admin)
+	require.True(t, scope.HasDir("photos"))
+	require.True(t, scope.HasDir("/photos/x/"))
+	require.False(t, scope.HasDir("photos2"))
+	require.True(t, scope.HasDir("docs/a/b"))
+	require.False(t, scope.HasDir("docs"))
+	require.False(t, scope.HasDir(""))
+	require.True(t, scope.HasKvsKey("cfg_main"))
+	require.False(t, scope.HasKvsKey("main"))
+	require.False(t, scope.HasDir("photos/.x"))     // written to "photosx"
+	require.True(t, scope.HasDir("photos/../docs")) // written to "photos/docs"
+	require.True(t, strings.HasPrefix(scope.Id, "key:"))
+	require.NotContains(t, scope.Id, "key1")
+
+	scope, err = authCore.Auth.GetScope("key2")
+	require.Nil(t, err)
+	require.True(t, scope.Admin)
+	require.True(t, scope.HasDir("any/dir"))
+	require.False(t, scope.HasKvsKey("any"))
+
+	// checked dir is normalized as written one
+	scope = &types.AuthScopeSt{Dirs: []string{"user1"}}
+	require.True(t, scope.HasDir("user1/a"))
+	require.False(t, scope.HasDir("user1/.0"))  // written to "user10"
+	require.True(t, scope.HasDir("/user1/..0")) // written to "user1/0"
+
+	// checked kvs-key is normalized as written one
+	scope = &types.AuthScopeSt{KvsPrefixes: []string{"app."}}
+	require.True(t, scope.HasKvsKey("app.x"))
+	require.False(t, scope.HasKvsKey("app..x")) // written to "appx"
+
+	authHandler := rest.GetHandler(app.lg, authCore, false, nil, false)
+
+	for _, c := range []struct {
+		method string
+		uri    string
+		body   string
+	}{
+		{http.MethodPost, "/static/sign", `{"path":"photos/.x/a.jpg"}`},
+		{http.MethodDelete, "/static/photos/.x/a.jpg", ""},
+		{http.MethodGet, "/list/photos/.x", ""},
+	} {
+		req := httptest.NewRequest(c.method, c.uri, strings.NewReader(c.body))
+		req.Header.Set("Authorization", "Bearer key1")
+
+		rec := httptest.NewRecorder()
+		authHandler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusForbidden, rec.Code, c.uri)
+	}
+
+	createJwt := func(secret string, method jwt.SigningMethod, exp time.Time) string {
+		token, err := jwt.NewWithClaims(method, jwt.MapClaims{
+			"exp":  exp.Unix(),
+			"dirs": []string{"avatars"},
+			"kvs":  []string{"user_"},
+		}).SignedString([]byte(secret))
 		require.Nil(t, err)
-		require.NotNil(t, fContent)
-		require.Equal(t, zp.c, string(fContent))
+		return token
 	}
 
-	fName, _, fContent, err := app.core.Static.Get(fPath, &types.ImgParsSt{}, false)
+	scope, err = authCore.Auth.GetScope(createJwt(jwtSecret, jwt.SigningMethodHS256, time.Now().Add(time.Minute)))
 	require.Nil(t, err)
-	require.Equal(t, "index.html", fName)
-	require.NotNil(t, fContent)
-	require.Equal(t, "some html content", string(fContent))
+	require.False(t, scope.Admin)
+	require.True(t, scope.HasDir("avatars"))
+	require.False(t, scope.HasDir("photos"))
+	require.True(t, scope.HasKvsKey("user_1"))
+
+	_, err = authCore.Auth.GetScope(createJwt(jwtSecret, jwt.SigningMethodHS256, time.Now().Add(-time.Minute)))
+	require.Equal(t, dopErrs.NotAuthorized, err)
+
+	_, err = authCore.Auth.GetScope(createJwt("bad_secret", jwt.SigningMethodHS256, time.Now().Add(time.Minute)))
+	require.Equal(t, dopErrs.NotAuthorized, err)
 
-	fName, _, fContent, err = app.core.Static.Get(fPath, &types.ImgParsSt{}, true)
+	_, err = authCore.Auth.GetScope(createJwt(jwtSecret, jwt.SigningMethodHS512, time.Now().Add(time.Minute)))
+	require.Equal(t, dopErrs.NotAuthorized, err)
+
+	// without exp
+	noExpToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"dirs": []string{"avatars"},
+	}).SignedString([]byte(jwtSecret))
 	require.Nil(t, err)
-	require.True(t, strings.HasSuffix(fName, ".zip"))
-	require.NotNil(t, fContent)
 
-	resultZipFiles, err := extractZipArchive(fContent)
+	_, err = authCore.Auth.GetScope(noExpToken)
+	require.Equal(t, dopErrs.NotAuthorized, err)
+}
+
+func TestSign(t *testing.T) {
+	signCore := newTestCore(storageMem.New(), nil, func(conf *core.ConfSt) {
+		conf.ZipLimits = types.ZipLimitsSt{MaxRatio: zipMaxRatio}
+		conf.UrlSignSecret = "sign_secret"
+		conf.PrivateDirPaths = []string{"/docs/", "private"}
+	})
+
+	require.True(t, signCore.Sign.IsPrivate("/docs/2020/01/01/a.pdf"))
+	require.True(t, signCore.Sign.IsPrivate("private"))
+	require.False(t, signCore.Sign.IsPrivate("docs2/a.pdf"))
+	require.False(t, signCore.Sign.IsPrivate("photos/a.jpg"))
+
+	_, err := app.core.Sign.Create("docs/a.pdf", time.Minute, nil)
+	require.Equal(t, errs.SignNotConfigured, err)
+
+	query, err := signCore.Sign.Create("docs/a.pdf", time.Minute, nil)
 	require.Nil(t, err)
-	zipContentIsSame(srcZipFiles, resultZipFiles)
+	require.Nil(t, signCore.Sign.Check("/docs/a.pdf", query))
 
-	srcZipFiles = []fsItemSt{
-		{p: "root/index.html", c: "some html content"},
-		{p: "root/abc/file.txt", c: "file content"},
-		{p: "root/abc/qwe/x.txt", c: "x content"},
-		{p: "root/todo.txt", c: "todo content"},
-	}
+	// not bound to image params
+	query.Set("w", "100")
+	require.Nil(t, signCore.Sign.Check("/docs/a.pdf", query))
 
-	zipBuffer, err = createZipArchive(srcZipFiles)
+	require.Equal(t, errs.BadSignature, signCore.Sign.Check("docs/b.pdf", query))
+	require.Equal(t, errs.BadSignature, signCore.Sign.Check("docs/a.pdf", url.Values{}))
+
+	query.Set("exp", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	require.Equal(t, errs.BadSignature, signCore.Sign.Check("docs/a.pdf", query))
+
+	// bound to image params
+	query, err = signCore.Sign.Create("docs/a.jpg", time.Minute, url.Values{"w": {"100"}, "h": {"100"}})
 	require.Nil(t, err)
+	require.Nil(t, signCore.Sign.Check("docs/a.jpg", query))
 
-	fPath, err = app.core.Static.Create("zip", "a.zip", zipBuffer, false, true)
+	query.Set("w", "2000")
+	require.Equal(t, errs.BadSignature, signCore.Sign.Check("docs/a.jpg", query))
+
+	query.Del("w")
+	require.Equal(t, errs.BadSignature, signCore.Sign.Check("docs/a.jpg", query))
+
+	query, err = signCore.Sign.Create("docs/a.pdf", -time.Minute, nil)
 	require.Nil(t, err)
-	require.True(t, strings.HasSuffix(fPath, "/"))
+	require.Nil(t, signCore.Sign.Check("docs/a.pdf", query)) // non-positive ttl is replaced with default
 
-	for _, zp := range srcZipFiles {
-		_, _, fContent, err := app.core.Static.Get(fPath+strings.TrimLeft(zp.p, "root/"), &types.ImgParsSt{}, false)
-		require.Nil(t, err)
-		require.NotNil(t, fContent)
-		require.Equal(t, zp.c, string(fContent))
+	// expired
+
+	query, err = signCore.Sign.Create("docs/a.pdf", time.Second, nil)
+	require.Nil(t, err)
+	require.Nil(t, signCore.Sign.Check("docs/a.pdf", query))
+
+	time.Sleep(2100 * time.Millisecond)
+	require.Equal(t, errs.SignatureExpired, signCore.Sign.Check("docs/a.pdf", query))
+
+	// rest, signed url of zip-dir keeps trailing slash
+	zipBuffer, err := createZipArchive([]fsItemSt{{p: "index.html", c: "index"}})
+	require.Nil(t, err)
+
+	zipPath, err := signCore.Static.Create("docs", "a.zip", zipBuffer, true, true, nil)
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(zipPath, "/"))
+
+	handler := rest.GetHandler(app.lg, signCore, false, nil, false)
+
+	req := httptest.NewRequest(http.MethodPost, "/static/sign", strings.NewReader(`{"path":"`+zipPath+`"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	repObj := &rest.SignRepSt{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), repObj))
+	require.True(t, strings.HasPrefix(repObj.Url, "/static/"+zipPath+"?"), repObj.Url)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, repObj.Url, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "index", rec.Body.String())
+}
+
+func TestMemStorage(t *testing.T) {
+	memCore := newTestCore(storageMem.New(), nil, func(conf *core.ConfSt) {
+		conf.ZipLimits = types.ZipLimitsSt{
+			MaxSize:     zipMaxSize,
+			MaxFileSize: zipMaxFileSize,
+			MaxEntries:  zipMaxEntries,
+			MaxRatio:    zipMaxRatio,
+		}
+	})
+
+	fPath, err := memCore.Static.Create("docs", "data.txt", bytes.NewBuffer([]byte("test_data")), false, false, nil)
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(fPath, "docs/"+time.Now().Format("2006/01/02")+"/"))
+
+	_, _, fContent, err := getStatic(t, memCore, fPath, &types.ImgParsSt{}, false)
+	require.Nil(t, err)
+	require.Equal(t, "test_data", string(fContent))
+
+	srcZipFiles := []fsItemSt{
+		{p: "index.html", c: "some html content"},
+		{p: "abc/file.txt", c: "file content"},
 	}
 
-	fName, _, fContent, err = app.core.Static.Get(fPath, &types.ImgParsSt{}, false)
+	zipBuffer, err := createZipArchive(srcZipFiles)
+	require.Nil(t, err)
+
+	fPath, err = memCore.Static.Create("zip", "a.zip", zipBuffer, false, true, nil)
+	require.Nil(t, err)
+	require.True(t, strings.HasSuffix(fPath, "/"))
+
+	fName, _, fContent, err := getStatic(t, memCore, fPath, &types.ImgParsSt{}, false)
 	require.Nil(t, err)
 	require.Equal(t, "index.html", fName)
-	require.NotNil(t, fContent)
 	require.Equal(t, "some html content", string(fContent))
+
+	_, _, fContent, err = getStatic(t, memCore, fPath, &types.ImgParsSt{}, true)
+	require.Nil(t, err)
+
+	resultZipFiles, err := extractZipArchive(fContent)
+	require.Nil(t, err)
+	require.Equal(t, len(srcZipFiles), len(resultZipFiles))
+
+	err = memCore.Kvs.Set("key", bytes.NewBuffer([]byte("kvs_data")))
+	require.Nil(t, err)
+
+	kvsData, _, err := memCore.Kvs.Get("key")
+	require.Nil(t, err)
+	require.Equal(t, "kvs_data", string(kvsData))
+
+	err = memCore.Kvs.Remove("key")
+	require.Nil(t, err)
+
+	_, _, err = memCore.Kvs.Get("key")
+	require.Equal(t, dopErrs.ObjectNotFound, err)
 }
 
 // func TestClean(t *testing.T) {
@@ -424,6 +2309,108 @@ func TestCreateZip(t *testing.T) {
 // 	})
 // }
 
+// blockingStorageSt blocks reading of files until unblock is closed
+// failingPutStorageSt writes only part of data on failedPut-th call of Put and returns error
+type failingPutStorageSt struct {
+	storage.Storage
+	failedPut int
+	putCount  int
+}
+
+func (s *failingPutStorageSt) Put(p string, r io.Reader) error {
+	s.putCount++
+	if s.putCount != s.failedPut {
+		return s.Storage.Put(p, r)
+	}
+
+	err := s.Storage.Put(p, io.LimitReader(r, 10))
+	if err != nil {
+		return err
+	}
+
+	return errors.New("no space left on device")
+}
+
+type walkHookStorageSt struct {
+	storage.Storage
+	afterWalk func(s storage.Storage)
+}
+
+func (s *walkHookStorageSt) Walk(p string, fn storage.WalkFunc) error {
+	err := s.Storage.Walk(p, fn)
+	s.afterWalk(s.Storage)
+	return err
+}
+
+type blockingStorageSt struct {
+	storage.Storage
+	unblock  chan struct{}
+	getCount int64
+}
+
+// Get blocks reading of files and counts them, upload-metas are not affected
+func (s *blockingStorageSt) Get(p string) (io.ReadSeekCloser, error) {
+	if strings.HasPrefix(p, cns.MetaDirNamePrefix) {
+		return s.Storage.Get(p)
+	}
+
+	atomic.AddInt64(&s.getCount, 1)
+
+	f, err := s.Storage.Get(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockingReaderSt{ReadSeekCloser: f, unblock: s.unblock}, nil
+}
+
+type blockingReaderSt struct {
+	io.ReadSeekCloser
+	unblock chan struct{}
+}
+
+func (r *blockingReaderSt) Read(p []byte) (int, error) {
+	<-r.unblock
+	return r.ReadSeekCloser.Read(p)
+}
+
+// newTestCore creates core with test defaults, setConf (optional) overrides only needed fields
+func newTestCore(st storage.Storage, diskCacheStorage storage.Storage, setConf func(conf *core.ConfSt)) *core.St {
+	conf := core.ConfSt{
+		ImgMaxWidth:  imgMaxWidth,
+		ImgMaxHeight: imgMaxHeight,
+		CacheTtl:     time.Minute,
+	}
+
+	if setConf != nil {
+		setConf(&conf)
+	}
+
+	return core.New(app.lg, cleanerMock.New(), st, diskCacheStorage, conf, true)
+}
+
+func getStatic(t *testing.T, cr *core.St, reqPath string, imgPars *types.ImgParsSt, download bool) (string, time.Time, []byte, error) {
+	file, err := cr.Static.Get(reqPath, imgPars, download)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+	defer file.Close()
+
+	if file.WriteTo != nil {
+		buffer := new(bytes.Buffer)
+
+		err = file.WriteTo(buffer)
+		require.Nil(t, err)
+
+		return file.Name, file.ModTime, buffer.Bytes(), nil
+	}
+
+	fData, err := io.ReadAll(file.Content)
+	require.Nil(t, err)
+
+	return file.Name, file.ModTime, fData, nil
+}
+
 func createZipArchive(items []fsItemSt) (*bytes.Buffer, error) {
 	result := new(bytes.Buffer)
 